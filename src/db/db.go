@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 	"log"
 )
 
@@ -11,15 +12,22 @@ var (
 	closeChan chan bool
 )
 
-func Open() {
+// opens the database with the given driver ("mysql" or "sqlite3")
+// and data source name
+func Open(driver, source string) {
 	closeChan = make(chan bool)
 	var err error
-	Db, err = sql.Open("mysql",
-		"root:@tcp(127.0.0.1:3306)/mafia")
+	Db, err = sql.Open(driver, source)
 
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// sqlite only allows one writer and every ":memory:" connection is its own database
+	if driver == "sqlite3" {
+		Db.SetMaxOpenConns(1)
+	}
+
 	go func() {
 		<-closeChan
 		Db.Close()
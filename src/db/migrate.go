@@ -0,0 +1,329 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations are named <version>_<name>[.<dialect>].<up|down>.sql
+// a file with a dialect (mysql or sqlite3) overrides the shared one for that dialect
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version uint
+	Name    string
+	Applied bool
+	Time    time.Time
+}
+
+const timeForm = "2006-01-02 15:04:05"
+
+// Gets every migration for a dialect sorted by version
+func Migrations(dialect string) ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrationMap := make(map[uint]*Migration)
+	// whether the sql in a migration came from a dialect specific file
+	overridden := make(map[string]bool)
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+		parts := strings.Split(strings.TrimSuffix(fileName, ".sql"), ".")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, errors.New(fmt.Sprintf("Bad migration file name %s", fileName))
+		}
+
+		direction := parts[len(parts)-1]
+		if direction != "up" && direction != "down" {
+			return nil, errors.New(fmt.Sprintf("Bad migration direction in %s", fileName))
+		}
+
+		fileDialect := ""
+		if len(parts) == 3 {
+			fileDialect = parts[1]
+			if fileDialect != dialect {
+				continue
+			}
+		}
+
+		underscore := strings.Index(parts[0], "_")
+		if underscore <= 0 {
+			return nil, errors.New(fmt.Sprintf("Bad migration file name %s", fileName))
+		}
+		version, err := strconv.Atoi(parts[0][:underscore])
+		if err != nil || version <= 0 {
+			return nil, errors.New(fmt.Sprintf("Bad migration version in %s", fileName))
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := migrationMap[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: parts[0][underscore+1:]}
+			migrationMap[uint(version)] = m
+		}
+
+		key := fmt.Sprintf("%d.%s", version, direction)
+		if fileDialect == "" && overridden[key] {
+			continue
+		}
+		if fileDialect != "" {
+			overridden[key] = true
+		}
+
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(migrationMap))
+	for _, m := range migrationMap {
+		if m.Up == "" {
+			return nil, errors.New(fmt.Sprintf("Migration %d has no up file", m.Version))
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// splits a migration file into statements
+// statements end with a ; at the end of a line
+func splitStatements(contents string) []string {
+	statements := make([]string, 0)
+	var current []string
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";"))
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		statements = append(statements, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+	return statements
+}
+
+func ensureVersionTable(d *sql.DB) error {
+	_, err := d.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+	version INT UNSIGNED NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied DATETIME NOT NULL
+)`)
+	return err
+}
+
+// gets the applied migration versions and when they were applied
+func appliedVersions(d *sql.DB) (map[uint]time.Time, error) {
+	err := ensureVersionTable(d)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint]time.Time)
+
+	rows, err := d.Query("SELECT version, applied FROM schema_version")
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var version uint
+		var appliedTime interface{}
+		if err := rows.Scan(&version, &appliedTime); err != nil {
+			return nil, err
+		}
+		applied[version] = parseTime(appliedTime)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// MySQL returns DATETIME as bytes while SQLite returns a time
+func parseTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC()
+	case []byte:
+		parsed, _ := time.Parse(timeForm, string(t))
+		return parsed
+	case string:
+		parsed, _ := time.Parse(timeForm, t)
+		return parsed
+	}
+	return time.Time{}
+}
+
+// runs a migration's statements and records the change to schema_version in one transaction
+// MySQL commits DDL implicitly, so a failed MySQL migration may need cleaning up by hand
+func runMigration(d *sql.DB, m Migration, up bool) error {
+	contents := m.Up
+	if !up {
+		contents = m.Down
+	}
+
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range splitStatements(contents) {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			tx.Rollback()
+			return errors.New(fmt.Sprintf("Migration %d_%s failed: %s", m.Version, m.Name, err))
+		}
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_version (version, name, applied) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC().Format(timeForm))
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_version WHERE version=?", m.Version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// whether a table exists, by selecting from it
+func tableExists(d *sql.DB, table string) bool {
+	rows, err := d.Query(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", table))
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// records a migration as applied without running it
+func stampMigration(d *sql.DB, m Migration) error {
+	_, err := d.Exec("INSERT INTO schema_version (version, name, applied) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().UTC().Format(timeForm))
+	return err
+}
+
+// Applies every migration that has not been applied yet in order
+// databases whose tables were made by hand before there were migrations have the first one stamped instead of run
+// returns the migrations that were applied
+func MigrateUp(d *sql.DB, dialect string) ([]Migration, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(d)
+	if err != nil {
+		return nil, err
+	}
+
+	ran := make([]Migration, 0)
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if m.Version == 1 && tableExists(d, "games") {
+			err = stampMigration(d, m)
+			if err != nil {
+				return ran, err
+			}
+			continue
+		}
+		err = runMigration(d, m, true)
+		if err != nil {
+			return ran, err
+		}
+		ran = append(ran, m)
+	}
+
+	return ran, nil
+}
+
+// Reverts the latest steps applied migrations
+// returns the migrations that were reverted
+func MigrateDown(d *sql.DB, dialect string, steps int) ([]Migration, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(d)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := make([]Migration, 0)
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return reverted, errors.New(fmt.Sprintf("Migration %d_%s cannot be reverted", m.Version, m.Name))
+		}
+		err = runMigration(d, m, false)
+		if err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, m)
+	}
+
+	return reverted, nil
+}
+
+// Gets whether each migration has been applied
+func GetMigrationStatus(d *sql.DB, dialect string) ([]MigrationStatus, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(d)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		appliedTime, ok := applied[m.Version]
+		statuses[i] = MigrationStatus{m.Version, m.Name, ok, appliedTime}
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,4 @@
+DROP TABLE count;
+DROP TABLE moves;
+DROP TABLE players;
+DROP TABLE games;
@@ -0,0 +1,40 @@
+-- base tables for games, players, moves and the ID counters
+CREATE TABLE games (
+	gameid INT UNSIGNED NOT NULL PRIMARY KEY,
+	stage INT NOT NULL,
+	started DATETIME NOT NULL,
+	modified DATETIME NOT NULL,
+	turncount INT UNSIGNED NOT NULL,
+	options BIGINT UNSIGNED NOT NULL
+);
+
+CREATE TABLE players (
+	playerid INT UNSIGNED NOT NULL PRIMARY KEY,
+	gameid INT UNSIGNED NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	role INT UNSIGNED NOT NULL,
+	alive BOOLEAN NOT NULL
+);
+
+CREATE INDEX players_gameid ON players (gameid);
+
+CREATE TABLE moves (
+	gameid INT UNSIGNED NOT NULL,
+	turncount INT UNSIGNED NOT NULL,
+	playerid INT UNSIGNED NOT NULL,
+	targetid INT UNSIGNED NOT NULL,
+	type INT UNSIGNED NOT NULL,
+	time DATETIME NOT NULL,
+	PRIMARY KEY (gameid, turncount, playerid)
+);
+
+CREATE TABLE count (
+	type VARCHAR(16) NOT NULL PRIMARY KEY,
+	count INT UNSIGNED NOT NULL,
+	scale INT UNSIGNED NOT NULL,
+	addConst INT UNSIGNED NOT NULL
+);
+
+-- scale has to be odd so that ids cycle through all 65536 values
+INSERT INTO count (type, count, scale, addConst) VALUES ('games', 0, 40503, 12345);
+INSERT INTO count (type, count, scale, addConst) VALUES ('players', 0, 30011, 5051);
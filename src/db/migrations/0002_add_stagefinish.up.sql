@@ -0,0 +1,2 @@
+-- deadline for the current stage, NULL when the stage is not timed
+ALTER TABLE games ADD COLUMN stagefinish DATETIME NULL;
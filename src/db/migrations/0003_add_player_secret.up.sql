@@ -0,0 +1,2 @@
+-- secret token handed to a player when they register
+ALTER TABLE players ADD COLUMN secret VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE games DROP COLUMN pauseremaining;
+ALTER TABLE games DROP COLUMN paused;
+ALTER TABLE games DROP COLUMN moderatorsecret;
@@ -0,0 +1,6 @@
+-- token the host uses to run the game, set when the game is made
+ALTER TABLE games ADD COLUMN moderatorsecret VARCHAR(64) NOT NULL DEFAULT '';
+-- whether the moderator paused the stage timer
+ALTER TABLE games ADD COLUMN paused BOOLEAN NOT NULL DEFAULT FALSE;
+-- seconds left on the stage timer while it is paused
+ALTER TABLE games ADD COLUMN pauseremaining INT UNSIGNED NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE players DROP COLUMN ready;
+DROP INDEX games_joincode ON games;
+ALTER TABLE games DROP COLUMN joincode;
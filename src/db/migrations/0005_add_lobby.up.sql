@@ -0,0 +1,5 @@
+-- code players join an open lobby with, NULL once the game starts
+ALTER TABLE games ADD COLUMN joincode VARCHAR(8) NULL;
+CREATE UNIQUE INDEX games_joincode ON games (joincode);
+-- whether the player is ready for the lobby to start
+ALTER TABLE players ADD COLUMN ready BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,12 @@
+-- chat messages, playerid is 0 for the moderator
+CREATE TABLE chat (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	gameid INT UNSIGNED NOT NULL,
+	channel VARCHAR(16) NOT NULL,
+	playerid INT UNSIGNED NOT NULL,
+	turncount INT UNSIGNED NOT NULL,
+	text TEXT NOT NULL,
+	time DATETIME NOT NULL
+);
+
+CREATE INDEX chat_gameid_channel ON chat (gameid, channel, id);
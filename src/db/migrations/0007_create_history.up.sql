@@ -0,0 +1,9 @@
+-- every change to a game in the order it happened, only ever appended to
+CREATE TABLE history (
+	gameid INT UNSIGNED NOT NULL,
+	seq INT UNSIGNED NOT NULL,
+	type VARCHAR(16) NOT NULL,
+	data TEXT NOT NULL,
+	time DATETIME NOT NULL,
+	PRIMARY KEY (gameid, seq)
+);
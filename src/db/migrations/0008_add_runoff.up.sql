@@ -0,0 +1,2 @@
+-- comma separated targets of the day's runoff vote, empty when there is none
+ALTER TABLE games ADD COLUMN runoff VARCHAR(512) NOT NULL DEFAULT '';
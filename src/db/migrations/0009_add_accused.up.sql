@@ -0,0 +1,2 @@
+-- player on trial during a day held with trials, 0 when nobody is
+ALTER TABLE games ADD COLUMN accused INT UNSIGNED NOT NULL DEFAULT 0;
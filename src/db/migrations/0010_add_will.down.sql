@@ -0,0 +1,2 @@
+ALTER TABLE players DROP COLUMN lastwords;
+ALTER TABLE players DROP COLUMN will;
@@ -0,0 +1,4 @@
+-- will the player leaves behind, revealed when they die
+ALTER TABLE players ADD COLUMN will VARCHAR(500) NOT NULL DEFAULT '';
+-- what the player said after being lynched
+ALTER TABLE players ADD COLUMN lastwords VARCHAR(500) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- what was revealed about the player when they died
+ALTER TABLE players ADD COLUMN reveal INT UNSIGNED NOT NULL DEFAULT 0;
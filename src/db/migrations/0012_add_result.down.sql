@@ -0,0 +1,2 @@
+ALTER TABLE players DROP COLUMN cause;
+ALTER TABLE games DROP COLUMN result;
@@ -0,0 +1,4 @@
+-- how the game ended and who won it as json, NULL until it ends
+ALTER TABLE games ADD COLUMN result TEXT NULL;
+-- how the player died, empty while they are alive
+ALTER TABLE players ADD COLUMN cause VARCHAR(16) NOT NULL DEFAULT '';
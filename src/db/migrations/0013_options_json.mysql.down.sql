@@ -0,0 +1,31 @@
+-- packs the options back into bits, counts too big for their old bits are cut down to the most they could hold
+ALTER TABLE games ADD COLUMN packed BIGINT UNSIGNED NOT NULL DEFAULT 0;
+UPDATE games SET packed =
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.SherriffCount') AS UNSIGNED), 0), 3) << 0) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.DoctorCount') AS UNSIGNED), 0), 3) << 2) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.MafiaCount') AS UNSIGNED), 0), 15) << 4) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.PlayerCount') AS UNSIGNED), 0), 63) << 8) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.DayTimeIntervals') AS UNSIGNED), 0), 255) << 14) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.NightTimeIntervals') AS UNSIGNED), 0), 255) << 22) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.VotingSystem') AS UNSIGNED), 0), 3) << 30) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.Trials') AS UNSIGNED), 0), 1) << 32) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.NominationSeconds') AS UNSIGNED), 0), 7) << 33) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.DefenseIntervals') AS UNSIGNED), 0), 15) << 36) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.JudgmentIntervals') AS UNSIGNED), 0), 15) << 40) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.LastWordsIntervals') AS UNSIGNED), 0), 15) << 44) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.DeathReveal') AS UNSIGNED), 0), 3) << 48) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.MafiaParity') AS UNSIGNED), 0), 1) << 50) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.JesterCount') AS UNSIGNED), 0), 1) << 51) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.SerialKillerCount') AS UNSIGNED), 0), 1) << 52) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.SurvivorCount') AS UNSIGNED), 0), 1) << 53) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.VigilanteCount') AS UNSIGNED), 0), 1) << 54) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.BodyguardCount') AS UNSIGNED), 0), 1) << 55) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.RoleblockerCount') AS UNSIGNED), 0), 1) << 56) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.TrackerCount') AS UNSIGNED), 0), 1) << 57) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.LookoutCount') AS UNSIGNED), 0), 1) << 58) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.GodfatherCount') AS UNSIGNED), 0), 1) << 59) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.FramerCount') AS UNSIGNED), 0), 1) << 60) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.JanitorCount') AS UNSIGNED), 0), 1) << 61) |
+	(LEAST(IFNULL(CAST(JSON_EXTRACT(options, '$.ConsortCount') AS UNSIGNED), 0), 1) << 62);
+ALTER TABLE games DROP COLUMN options;
+ALTER TABLE games CHANGE packed options BIGINT UNSIGNED NOT NULL;
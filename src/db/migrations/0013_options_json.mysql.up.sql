@@ -0,0 +1,31 @@
+-- options are stored as json instead of being packed into 63 bits, so role counts are no longer held to a bit or two
+ALTER TABLE games ADD COLUMN settings TEXT;
+UPDATE games SET settings = CONCAT(
+	'{"PlayerCount":', ((options >> 8) & 63),
+	',"MafiaCount":', ((options >> 4) & 15),
+	',"DoctorCount":', ((options >> 2) & 3),
+	',"SherriffCount":', ((options >> 0) & 3),
+	',"DayTimeIntervals":', ((options >> 14) & 255),
+	',"NightTimeIntervals":', ((options >> 22) & 255),
+	',"VotingSystem":', ((options >> 30) & 3),
+	',"Trials":', ((options >> 32) & 1),
+	',"NominationSeconds":', ((options >> 33) & 7),
+	',"DefenseIntervals":', ((options >> 36) & 15),
+	',"JudgmentIntervals":', ((options >> 40) & 15),
+	',"LastWordsIntervals":', ((options >> 44) & 15),
+	',"DeathReveal":', ((options >> 48) & 3),
+	',"MafiaParity":', ((options >> 50) & 1),
+	',"JesterCount":', ((options >> 51) & 1),
+	',"SerialKillerCount":', ((options >> 52) & 1),
+	',"SurvivorCount":', ((options >> 53) & 1),
+	',"VigilanteCount":', ((options >> 54) & 1),
+	',"BodyguardCount":', ((options >> 55) & 1),
+	',"RoleblockerCount":', ((options >> 56) & 1),
+	',"TrackerCount":', ((options >> 57) & 1),
+	',"LookoutCount":', ((options >> 58) & 1),
+	',"GodfatherCount":', ((options >> 59) & 1),
+	',"FramerCount":', ((options >> 60) & 1),
+	',"JanitorCount":', ((options >> 61) & 1),
+	',"ConsortCount":', ((options >> 62) & 1), '}');
+ALTER TABLE games DROP COLUMN options;
+ALTER TABLE games CHANGE settings options TEXT NOT NULL;
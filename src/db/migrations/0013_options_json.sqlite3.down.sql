@@ -0,0 +1,31 @@
+-- packs the options back into bits, counts too big for their old bits are cut down to the most they could hold
+ALTER TABLE games ADD COLUMN packed BIGINT NOT NULL DEFAULT 0;
+UPDATE games SET packed =
+	(min(IFNULL(json_extract(options, '$.SherriffCount'), 0), 3) << 0) |
+	(min(IFNULL(json_extract(options, '$.DoctorCount'), 0), 3) << 2) |
+	(min(IFNULL(json_extract(options, '$.MafiaCount'), 0), 15) << 4) |
+	(min(IFNULL(json_extract(options, '$.PlayerCount'), 0), 63) << 8) |
+	(min(IFNULL(json_extract(options, '$.DayTimeIntervals'), 0), 255) << 14) |
+	(min(IFNULL(json_extract(options, '$.NightTimeIntervals'), 0), 255) << 22) |
+	(min(IFNULL(json_extract(options, '$.VotingSystem'), 0), 3) << 30) |
+	(min(IFNULL(json_extract(options, '$.Trials'), 0), 1) << 32) |
+	(min(IFNULL(json_extract(options, '$.NominationSeconds'), 0), 7) << 33) |
+	(min(IFNULL(json_extract(options, '$.DefenseIntervals'), 0), 15) << 36) |
+	(min(IFNULL(json_extract(options, '$.JudgmentIntervals'), 0), 15) << 40) |
+	(min(IFNULL(json_extract(options, '$.LastWordsIntervals'), 0), 15) << 44) |
+	(min(IFNULL(json_extract(options, '$.DeathReveal'), 0), 3) << 48) |
+	(min(IFNULL(json_extract(options, '$.MafiaParity'), 0), 1) << 50) |
+	(min(IFNULL(json_extract(options, '$.JesterCount'), 0), 1) << 51) |
+	(min(IFNULL(json_extract(options, '$.SerialKillerCount'), 0), 1) << 52) |
+	(min(IFNULL(json_extract(options, '$.SurvivorCount'), 0), 1) << 53) |
+	(min(IFNULL(json_extract(options, '$.VigilanteCount'), 0), 1) << 54) |
+	(min(IFNULL(json_extract(options, '$.BodyguardCount'), 0), 1) << 55) |
+	(min(IFNULL(json_extract(options, '$.RoleblockerCount'), 0), 1) << 56) |
+	(min(IFNULL(json_extract(options, '$.TrackerCount'), 0), 1) << 57) |
+	(min(IFNULL(json_extract(options, '$.LookoutCount'), 0), 1) << 58) |
+	(min(IFNULL(json_extract(options, '$.GodfatherCount'), 0), 1) << 59) |
+	(min(IFNULL(json_extract(options, '$.FramerCount'), 0), 1) << 60) |
+	(min(IFNULL(json_extract(options, '$.JanitorCount'), 0), 1) << 61) |
+	(min(IFNULL(json_extract(options, '$.ConsortCount'), 0), 1) << 62);
+ALTER TABLE games DROP COLUMN options;
+ALTER TABLE games RENAME COLUMN packed TO options;
@@ -0,0 +1,172 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// chat channels
+const (
+	TownChannel      = "Town"      // everyone can read, living players talk during the day
+	MafiaChannel     = "Mafia"     // only mafia can read, living mafia talk at night
+	DeadChannel      = "Dead"      // dead players and spectators read, dead players talk
+	ModeratorChannel = "Moderator" // everyone can read, only the moderator talks
+)
+
+var ChatChannels = []string{TownChannel, MafiaChannel, DeadChannel, ModeratorChannel}
+
+// longest chat message that can be sent
+const maxChatLength = 500
+
+// most chat messages fetched at once
+const MaxChatPage = 100
+
+// ChatMessage is one message sent in a game's chat
+type ChatMessage struct {
+	ID        uint
+	GameID    uint
+	Channel   string
+	PlayerID  uint // 0 for the moderator
+	TurnCount uint
+	Text      string
+	Time      time.Time
+}
+
+// finds the viewer's player, nil for spectators and the moderator
+func (g *Game) viewerPlayer(v Viewer) *Player {
+	if v.PlayerID == 0 {
+		return nil
+	}
+	p, err := g.FindPlayerWithID(v.PlayerID)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// whether the player plays for the mafia
+func isMafia(p *Player) bool {
+	return p != nil && p.Role() != nil && p.Role().Team() == MafiaTeam
+}
+
+// Whether the viewer can read a channel
+// the moderator can read everything, and so can everyone once the game is over
+func (g *Game) CanReadChannel(v Viewer, channel string) bool {
+	if g.seesAll(v) {
+		return true
+	}
+	p := g.viewerPlayer(v)
+
+	switch channel {
+	case TownChannel, ModeratorChannel:
+		return true
+	case MafiaChannel:
+		return isMafia(p)
+	case DeadChannel:
+		// spectators can read it as they have no part in the game
+		return p == nil || !p.Alive
+	}
+	return false
+}
+
+// checks the viewer can send a message to a channel right now
+func (g *Game) checkCanPost(v Viewer, channel string) error {
+	if channel == ModeratorChannel {
+		if !v.Moderator {
+			return errors.New("Only the moderator can talk in the Moderator channel")
+		}
+		return nil
+	}
+	if v.Moderator {
+		return errors.New("The moderator can only talk in the Moderator channel")
+	}
+
+	p := g.viewerPlayer(v)
+	if p == nil {
+		return errors.New("Spectators cannot talk")
+	}
+
+	switch channel {
+	case TownChannel:
+		if !p.Alive {
+			return errors.New("Dead players cannot talk in the Town channel")
+		}
+		if !g.IsDay() {
+			return errors.New("The Town channel is only open during the day")
+		}
+		if g.Stage == DefenseStage && p.PlayerID != g.Accused {
+			return errors.New("Only the accused can talk during their defense")
+		}
+	case MafiaChannel:
+		if !isMafia(p) || !p.Alive {
+			return errors.New("Only living mafia can talk in the Mafia channel")
+		}
+		if g.Stage != 1 {
+			return errors.New("The Mafia channel is only open at night")
+		}
+	case DeadChannel:
+		if p.Alive {
+			return errors.New("Only dead players can talk in the Dead channel")
+		}
+	default:
+		return errors.New(fmt.Sprintf("Unknown channel %s", channel))
+	}
+	return nil
+}
+
+// Sends a chat message from the viewer
+// it is stored and sent to every connection that can read the channel
+func (g *Game) PostChat(v Viewer, channel string, text string) (*ChatMessage, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, errors.New("Message cannot be empty")
+	}
+	if len(text) > maxChatLength {
+		return nil, errors.New(fmt.Sprintf("Message cannot be longer than %d characters", maxChatLength))
+	}
+
+	err := g.checkCanPost(v, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	m := ChatMessage{
+		GameID:    g.GameID,
+		Channel:   channel,
+		PlayerID:  v.PlayerID,
+		TurnCount: g.TurnCount,
+		Text:      text,
+		Time:      time.Now().UTC(),
+	}
+	err = g.db().InsertChatMessage(&m)
+	if err != nil {
+		return nil, err
+	}
+
+	g.broadcastChat(&m)
+	return &m, nil
+}
+
+// Gets a page of a channel's messages the viewer can read, oldest first
+// before is the ID messages have to be older than, 0 for the newest
+func (g *Game) GetChat(v Viewer, channel string, before uint, limit int) ([]*ChatMessage, error) {
+	if !g.CanReadChannel(v, channel) {
+		return nil, errors.New(fmt.Sprintf("Cannot read the %s channel", channel))
+	}
+	if limit <= 0 || limit > MaxChatPage {
+		limit = MaxChatPage
+	}
+
+	messages, err := g.db().GetChatMessages(g.GameID, channel, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// the store gives newest first so the page ends at before
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
@@ -1,34 +1,36 @@
 package game
 
 import (
-	"db"
-	"fmt"
 	"strings"
 	"sync"
 )
 
-var mutexMap = make(map[string]*sync.Mutex)
+// locks for each type of id, so a new id is never handed out twice
+var mutexMap = map[string]*sync.Mutex{
+	"games":   &sync.Mutex{},
+	"players": &sync.Mutex{},
+}
 
 // checks if a id already exists in the database
-func checkGameIDConflict(id uint) (bool, error) {
-	return checkIDConflict(id, "game")
+func checkGameIDConflict(s Store, id uint) (bool, error) {
+	return checkIDConflict(s, id, "game")
 }
 
-func getUniqueGameID() (uint, error) {
-	return getUniqueID("game")
+func getUniqueGameID(s Store) (uint, error) {
+	return getUniqueID(s, "game")
 }
 
 // checks if a id already exists in the database
-func checkPlayerIDConflict(id uint) (bool, error) {
-	return checkIDConflict(id, "player")
+func checkPlayerIDConflict(s Store, id uint) (bool, error) {
+	return checkIDConflict(s, id, "player")
 }
 
-func getUniquePlayerID() (uint, error) {
-	return getUniqueID("player")
+func getUniquePlayerID(s Store) (uint, error) {
+	return getUniqueID(s, "player")
 }
 
 // gets a unique id for a new game
-func getUniqueID(idType string) (uint, error) {
+func getUniqueID(s Store, idType string) (uint, error) {
 
 	var key string
 	if strings.Contains(strings.ToLower(idType), "game") {
@@ -37,15 +39,7 @@ func getUniqueID(idType string) (uint, error) {
 		key = "players"
 	}
 
-	mutex, ok := mutexMap[key]
-	if !ok {
-		mutexMap[key] = &sync.Mutex{}
-		mutex, _ = mutexMap[key]
-	}
-
-	var count uint
-	var scale uint
-	var addConst uint
+	mutex := mutexMap[key]
 
 	var newID uint
 
@@ -55,7 +49,7 @@ func getUniqueID(idType string) (uint, error) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	err := db.Db.QueryRow(fmt.Sprintf("SELECT count, scale, addConst FROM count WHERE type='%s'", key)).Scan(&count, &scale, &addConst)
+	count, scale, addConst, err := s.GetCounter(key)
 	if err != nil {
 		return 0, err
 	}
@@ -63,18 +57,13 @@ func getUniqueID(idType string) (uint, error) {
 	for conflict || newID == 0 {
 		count += 1
 		newID = (count*scale + addConst) % 65536
-		conflict, err = checkIDConflict(newID, idType)
+		conflict, err = checkIDConflict(s, newID, idType)
 		if err != nil {
 			return 0, err
 		}
 	}
 
-	updateCount, err := db.Db.Prepare(fmt.Sprintf("UPDATE count SET count=? WHERE type='%s'", key))
-	if err != nil {
-		return newID, err
-	}
-
-	_, err = updateCount.Exec(count)
+	err = s.SetCounter(key, count)
 	if err != nil {
 		return newID, err
 	}
@@ -82,17 +71,6 @@ func getUniqueID(idType string) (uint, error) {
 	return newID, nil
 }
 
-func checkIDConflict(id uint, idType string) (bool, error) {
-	collision := 1
-	var key string
-	var table string
-	if strings.Contains(strings.ToLower(idType), "game") {
-		table = "games"
-		key = "gameid"
-	} else if strings.Contains(strings.ToLower(idType), "player") {
-		table = "players"
-		key = "playerid"
-	}
-	err := db.Db.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE %s=?)", table, key), id).Scan(&collision)
-	return collision != 0, err
+func checkIDConflict(s Store, id uint, idType string) (bool, error) {
+	return s.IDExists(idType, id)
 }
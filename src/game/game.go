@@ -1,14 +1,12 @@
 package game
 
 import (
-	"database/sql"
-	"db"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"time"
-	"ws"
 )
 
 //golang constant thingy
@@ -17,107 +15,151 @@ const sqlForm = "2006-01-02 15:04:05"
 
 // Game is the class that represents all of the mafia game data
 
-// Stored as a 32 bit int
+// Stored as json
 type GameOptions struct {
-	PlayerCount        uint // 6 bits
-	MafiaCount         uint // 4 bits
-	DoctorCount        uint // 2 bits
-	SherriffCount      uint // 2 bits
-	DayTimeIntervals   uint // 8 bits
-	NightTimeIntervals uint // 8 bits
+	PlayerCount        uint
+	MafiaCount         uint
+	DoctorCount        uint
+	SherriffCount      uint
+	DayTimeIntervals   uint
+	NightTimeIntervals uint
+	VotingSystem       uint
+	Trials             uint // whether the day is held with nominations and trials
+	NominationSeconds  uint // players besides the nominator needed to put someone on trial
+	DefenseIntervals   uint
+	JudgmentIntervals  uint
+	LastWordsIntervals uint // 0 for no last words after a lynch
+	DeathReveal        uint
+	MafiaParity        uint // whether the mafia win once they match everyone else alive
+	JesterCount        uint
+	SerialKillerCount  uint
+	SurvivorCount      uint
+	VigilanteCount     uint
+	BodyguardCount     uint
+	RoleblockerCount   uint
+	TrackerCount       uint
+	LookoutCount       uint
+	GodfatherCount     uint
+	FramerCount        uint
+	JanitorCount       uint
+	ConsortCount       uint
 }
 
 // time intervals are mulitples of 15 seconds
 
-// bit sizes of every field
-var GameOptionSizes = GameOptions{
-	PlayerCount:   6,
-	MafiaCount:    4,
-	DoctorCount:   2,
-	SherriffCount: 2,
+// most players a game can have
+const MaxPlayers = 63
+
+// an option that is not a role count, which can be from 0 up to max
+type optionLimit struct {
+	name  string
+	value uint
+	max   uint
 }
 
-func (o *GameOptions) Verify() error {
-	var max uint
-	max = 1 << GameOptionSizes.PlayerCount
-	if o.PlayerCount >= max {
-		return errors.New(fmt.Sprintf("PlayerCount is too large. Max is %d", max-1))
+// gets the limits of every option that is not a role count
+// role counts are only limited by there being enough players for them
+func (o *GameOptions) limits() []optionLimit {
+	return []optionLimit{
+		{"PlayerCount", o.PlayerCount, MaxPlayers},
+		{"DayTimeIntervals", o.DayTimeIntervals, 255},
+		{"NightTimeIntervals", o.NightTimeIntervals, 255},
+		{"VotingSystem", o.VotingSystem, uint(len(VotingSystemNames)) - 1},
+		{"Trials", o.Trials, 1},
+		{"NominationSeconds", o.NominationSeconds, 7},
+		{"DefenseIntervals", o.DefenseIntervals, 15},
+		{"JudgmentIntervals", o.JudgmentIntervals, 15},
+		{"LastWordsIntervals", o.LastWordsIntervals, 15},
+		{"DeathReveal", o.DeathReveal, uint(len(DeathRevealNames)) - 1},
+		{"MafiaParity", o.MafiaParity, 1},
 	}
+}
 
-	max = 1 << GameOptionSizes.MafiaCount
-	if o.MafiaCount >= max {
-		return errors.New(fmt.Sprintf("MafiaCount is too large. Max is %d", max-1))
+func (o *GameOptions) Verify() error {
+	for _, limit := range o.limits() {
+		if limit.value > limit.max {
+			return errors.New(fmt.Sprintf("%s is too large. Max is %d", limit.name, limit.max))
+		}
 	}
 
-	max = 1 << GameOptionSizes.DoctorCount
-	if o.DoctorCount >= max {
-		return errors.New(fmt.Sprintf("DoctorCount is too large. Max is %d", max-1))
+	// trials take the place of the day's vote
+	if o.Trials != 0 && o.VotingSystem != PluralityVoting {
+		return errors.New("VotingSystem cannot be used with Trials")
 	}
 
-	max = 1 << GameOptionSizes.SherriffCount
-	if o.SherriffCount >= max {
-		return errors.New(fmt.Sprintf("SherriffCount is too large. Max is %d", max-1))
+	var specialCount uint
+	for _, role := range Roles() {
+		if role.ID() != VillagerRole {
+			specialCount += role.Count(o)
+		}
+	}
+	if specialCount > o.PlayerCount {
+		return errors.New(fmt.Sprintf("There are %d roles for only %d players", specialCount, o.PlayerCount))
 	}
 
 	return nil
 }
 
-func (o *GameOptions) Encode() (uint, error) {
+// Writes the options as json for storing
+func (o *GameOptions) Encode() (string, error) {
 	err := o.Verify()
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
-	var total uint = 0
-
-	total <<= GameOptionSizes.PlayerCount
-	total += o.PlayerCount
-
-	total <<= GameOptionSizes.MafiaCount
-	total += o.MafiaCount
-
-	total <<= GameOptionSizes.DoctorCount
-	total += o.DoctorCount
-
-	total <<= GameOptionSizes.SherriffCount
-	total += o.SherriffCount
-
-	return total, nil
-}
-
-func GetLastNBits(a, n uint) uint {
-	var mask uint = 0
-	var i uint = 0
-	for ; i < n; i++ {
-		mask |= 1 << i
+	encoded, err := json.Marshal(o)
+	if err != nil {
+		return "", err
 	}
-	return a & mask
+	return string(encoded), nil
 }
 
-func DecodeGameOptions(encoded uint) (*GameOptions, error) {
+// Reads options written by Encode
+// options added since the game was stored are left at 0
+func DecodeGameOptions(encoded string) (*GameOptions, error) {
 	var retOptions GameOptions
+	err := json.Unmarshal([]byte(encoded), &retOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &retOptions, nil
+}
 
-	retOptions.SherriffCount = GetLastNBits(encoded, GameOptionSizes.SherriffCount)
-	encoded >>= GameOptionSizes.SherriffCount
-
-	retOptions.DoctorCount = GetLastNBits(encoded, GameOptionSizes.DoctorCount)
-	encoded >>= GameOptionSizes.DoctorCount
-
-	retOptions.MafiaCount = GetLastNBits(encoded, GameOptionSizes.MafiaCount)
-	encoded >>= GameOptionSizes.MafiaCount
-
-	retOptions.PlayerCount = GetLastNBits(encoded, GameOptionSizes.PlayerCount)
-	encoded >>= GameOptionSizes.PlayerCount
-
-	if encoded != 0 {
-		return nil, errors.New("Encoded GameOption has too many bits")
+// gets the deadline for a stage that lasts the given number of intervals
+// 0 intervals means the stage is not timed and gives a zero time
+func stageDeadline(intervals uint) time.Time {
+	if intervals == 0 {
+		return time.Time{}
 	}
+	return time.Now().UTC().Add(time.Duration(intervals) * 15 * time.Second)
+}
 
-	return &retOptions, nil
+// gets how many intervals the game's current stage lasts
+func (g *Game) stageIntervals() uint {
+	switch g.Stage {
+	case 1:
+		return g.Options.NightTimeIntervals
+	case 2:
+		return g.Options.DayTimeIntervals
+	case DefenseStage:
+		return g.Options.DefenseIntervals
+	case JudgmentStage:
+		return g.Options.JudgmentIntervals
+	case LastWordsStage:
+		return g.Options.LastWordsIntervals
+	}
+	return 0
 }
 
+// every player without another role is a villager
 func (o *GameOptions) VillagerCount() uint {
-	return o.PlayerCount - o.MafiaCount - o.DoctorCount - o.SherriffCount
+	count := o.PlayerCount
+	for _, role := range Roles() {
+		if role.ID() != VillagerRole {
+			count -= role.Count(o)
+		}
+	}
+	return count
 }
 
 // Metadata about the game
@@ -131,17 +173,52 @@ type Game struct {
 	Players     Players
 	Moves       Moves
 	Options     GameOptions
+	// code players join the lobby with, empty once the game starts
+	JoinCode string
+
+	// the moderator stopped the stage timer with this many seconds left
+	Paused         bool
+	PauseRemaining uint
+
+	// targets of the day's runoff vote, empty when there is none
+	Runoff []uint
+
+	// player on trial or giving their last words, 0 when nobody is
+	Accused uint
+
+	// how the game ended, nil until it does
+	Result *GameResult
+
+	moderatorSecret string
+
+	tx *gameTx // set while the game is inside of a transaction
+
+	// what each player learned from the night that was just processed
+	nightResults map[uint][]NightResult
 }
 
 // Creates a new game and uploads it to the database
+// the game and its players are uploaded in one transaction
 func MakeGame(options GameOptions) (*Game, error) {
-	err := db.Db.Ping()
+	var g *Game
+	err := store.Transact(func(tx Store) error {
+		var err error
+		g, err = makeGame(tx, options)
+		if err != nil {
+			return err
+		}
+		return recordCreated(tx, g)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return g, nil
+}
 
+func makeGame(s Store, options GameOptions) (*Game, error) {
+	var err error
 	var g Game
-	g.GameID, err = getUniqueGameID()
+	g.GameID, err = getUniqueGameID(s)
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +229,7 @@ func MakeGame(options GameOptions) (*Game, error) {
 	g.Players = make(Players, options.PlayerCount)
 	for i, _ := range g.Players {
 
-		g.Players[i], err = MakePlayer(g.GameID)
+		g.Players[i], err = makePlayer(s, g.GameID)
 		if err != nil {
 			return nil, err
 		}
@@ -161,109 +238,75 @@ func MakeGame(options GameOptions) (*Game, error) {
 	g.Moves = make(Moves, 0)
 	g.Options = options
 
-	_, err = g.Upload()
-
+	g.moderatorSecret, err = generateSecret()
 	if err != nil {
 		return nil, err
 	}
 
-	return &g, nil
-}
+	err = s.InsertGame(&g)
 
-// Gets a Game frome the database
-func GetGame(gameID uint) (*Game, error) {
-	err := db.Db.Ping()
 	if err != nil {
 		return nil, err
 	}
 
-	var game Game
-	game.GameID = gameID
-
-	var started, modified string
-	var encodedOptions uint
-
-	//TODO: handle NULLS
-	err = db.Db.QueryRow("SELECT stage, started, modified, turnCount, options FROM games WHERE gameid=?", gameID).Scan(&game.Stage, &started, &modified, &game.TurnCount, &encodedOptions)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("Game not found")
-		}
-		return nil, err
-	}
+	return &g, nil
+}
 
-	game.Started, err = time.Parse(sqlForm, started)
-	if err != nil {
-		return nil, err
-	}
-	game.Modified, err = time.Parse(sqlForm, modified)
-	if err != nil {
-		return nil, err
-	}
+// Gets a Game frome the database
+func GetGame(gameID uint) (*Game, error) {
+	return getGame(store, gameID)
+}
 
-	options, err := DecodeGameOptions(encodedOptions)
+func getGame(s Store, gameID uint) (*Game, error) {
+	game, err := s.GetGame(gameID)
 	if err != nil {
 		return nil, err
 	}
 
-	game.Options = *options
-
-	game.Players, err = GetGamePlayers(gameID)
+	game.Players, err = s.GetGamePlayers(gameID)
 	if err != nil {
 		return nil, err
 	}
 
-	game.Moves, err = GetGameMoves(gameID)
+	game.Moves, err = s.GetMoves(gameID, MoveFilter{})
 	if err != nil {
 		return nil, err
 	}
 
-	return &game, nil
+	return game, nil
 }
 
-// updates database version of the game
-func (g *Game) Upload() (sql.Result, error) {
-	encodedOptions, err := g.Options.Encode()
-	if err != nil {
-		return nil, err
-	}
-
-	err = db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	addGame, err := db.Db.Prepare("INSERT INTO games (gameid, stage, started, modified, turncount, options) VALUES (?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		return nil, err
-	}
-
-	return addGame.Exec(g.GameID, g.Stage, g.Started, g.Modified, g.TurnCount, encodedOptions)
+// uploads a new game to the database
+// Only uploads game and not players or moves
+func (g *Game) Upload() error {
+	return g.db().InsertGame(g)
 }
 
 // updates database version of the game
 // Only updates game and not players or moves
-func (g *Game) Update() (sql.Result, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	updateGame, err := db.Db.Prepare("UPDATE games SET stage=?, started=?, modified=?, turnCount=? WHERE gameid=?")
-	if err != nil {
-		return nil, err
-	}
+func (g *Game) Update() error {
+	return g.db().UpdateGame(g)
+}
 
-	result, err := updateGame.Exec(g.Stage, g.Started, g.Modified, g.TurnCount, g.GameID)
+// Validates and then makes a move
+// the move and any stage change it causes commit together
+func (g *Game) MakeGameMove(playerID uint, targetID uint, moveType uint) (map[string]interface{}, error) {
+	var retMap map[string]interface{}
+	err := g.transact(func(g *Game) error {
+		var err error
+		retMap, err = g.makeGameMove(playerID, targetID, moveType)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	return result, nil
+	return retMap, nil
 }
 
-// Validates and then makes a move
-func (g *Game) MakeGameMove(playerID uint, targetID uint, moveType uint) (map[string]interface{}, error) {
+func (g *Game) makeGameMove(playerID uint, targetID uint, moveType uint) (map[string]interface{}, error) {
+	if g.IsOver() {
+		return nil, ErrGameOver
+	}
 
 	p, err := g.FindPlayerWithID(playerID)
 	if err != nil {
@@ -281,38 +324,72 @@ func (g *Game) MakeGameMove(playerID uint, targetID uint, moveType uint) (map[st
 		}
 	}
 
+	role := p.Role()
+	if role == nil {
+		return nil, errors.New("Players without a role cannot move")
+	}
+
+	if g.Stage == LastWordsStage {
+		return nil, errors.New("No moves can be made during last words")
+	}
+
 	if g.Stage == 1 {
-		if p.role != moveType {
+		if role.ID() != moveType {
 			return nil, errors.New("Invalid move type, wrong role")
 		}
+		if targetID != 0 {
+			target, _ := g.FindPlayerWithID(targetID)
+			err = role.CheckMove(g, p, target)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if g.hasTrials() && g.IsDay() {
+		err = g.checkTrialMove(p, targetID, moveType)
+		if err != nil {
+			return nil, err
+		}
 	} else if g.Stage == 2 {
 		if moveType != 0 {
 			return nil, errors.New("Invalid move type, not vote")
 		}
+		if len(g.Runoff) != 0 && !g.inRunoff(targetID) {
+			return nil, errors.New("Target is not in the runoff")
+		}
 	}
 
-	createdMoves, err := GetGamePlayerTurnMoves(g.GameID, playerID, g.TurnCount)
+	createdMoves, err := g.db().GetMoves(g.GameID, MoveFilter{PlayerID: playerID, TurnCount: g.TurnCount})
 	if err != nil {
 		return nil, err
 	} else if len(createdMoves) == 0 {
 		// if the player has not yet made a move
-		move, err := MakeMove(g.GameID, g.TurnCount, playerID, targetID, moveType)
+		move, err := makeMove(g.db(), g.GameID, g.TurnCount, playerID, targetID, moveType)
 		if err != nil {
 			return nil, err
 		}
 		g.Moves = append(Moves{move}, g.Moves...) //prepend
+		err = g.record(EventMove, MoveData{TurnCount: g.TurnCount, PlayerID: playerID, TargetID: targetID, Type: moveType})
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		// if the player already made a move
-		if p.role == 4 { // sherriff
-			return nil, errors.New("Sherriff cannot change his move")
+		if g.Stage == 1 && role.NightAction().Final {
+			return nil, errors.New(fmt.Sprintf("%s cannot change their move", role.Name()))
 		}
 		for _, move := range g.Moves {
-			if move.PlayerID == playerID {
+			if move.PlayerID == playerID && move.TurnCount == g.TurnCount {
 
 				move.TargetID = targetID
 				move.Type = moveType
+				move.Time = time.Now().UTC()
 
-				_, err := move.Update()
+				err := g.db().UpdateMove(move)
+				if err != nil {
+					return nil, err
+				}
+				// the store only keeps the latest move, the history keeps every change
+				err = g.record(EventMove, MoveData{g.TurnCount, playerID, targetID, moveType, true})
 				if err != nil {
 					return nil, err
 				}
@@ -324,18 +401,7 @@ func (g *Game) MakeGameMove(playerID uint, targetID uint, moveType uint) (map[st
 
 	retMap := make(map[string]interface{})
 
-	// if a role has an immediate action
-	if targetID != 0 {
-		if moveType == 4 && g.Stage == 1 {
-			mafiaCheck, err := g.ProcessSherriffMove(targetID)
-			if err != nil {
-				return nil, err
-			}
-			retMap["Sherriff"] = mafiaCheck
-		}
-	}
-
-	moves, err := GetGameTurnMoves(g.GameID, g.TurnCount)
+	moves, err := g.db().GetMoves(g.GameID, MoveFilter{TurnCount: g.TurnCount})
 	if err != nil {
 		return nil, err
 	}
@@ -350,8 +416,8 @@ func (g *Game) MakeGameMove(playerID uint, targetID uint, moveType uint) (map[st
 	for _, player := range g.Players {
 		if _, ok := playerMoveMap[player.PlayerID]; !ok {
 
-			// dead players cant move
-			if !player.Alive {
+			// dead players cant move, and trials only wait on some players
+			if !g.mustMove(player) {
 				continue
 			}
 
@@ -360,12 +426,16 @@ func (g *Game) MakeGameMove(playerID uint, targetID uint, moveType uint) (map[st
 		}
 	}
 
-	if allPlayersMoved {
-		g.ProgressStage()
+	// a nomination seconded enough puts the nominee on trial straight away
+	if allPlayersMoved || (g.hasTrials() && g.Stage == 2 && nominee(moves, g.Options.NominationSeconds) != 0) {
+		err = g.progressStage()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	g.Modified = time.Now().UTC()
-	_, err = g.Update()
+	err = g.Update()
 	if err != nil {
 		return nil, err
 	}
@@ -373,29 +443,25 @@ func (g *Game) MakeGameMove(playerID uint, targetID uint, moveType uint) (map[st
 	return retMap, nil
 }
 
-func (g *Game) ProcessSherriffMove(targetID uint) (bool, error) {
-	p, err := g.FindPlayerWithID(targetID)
-	if err != nil {
-		return false, err
-	}
-
-	return p.role == 2, nil
-}
-
 func (g *Game) GetCurrentMoves() (Moves, error) {
-	return GetGameTurnMoves(g.GameID, g.TurnCount)
+	return g.db().GetMoves(g.GameID, MoveFilter{TurnCount: g.TurnCount})
 }
 
 func (g *Game) RegisterPlayer(name string) error {
+	return g.transact(func(g *Game) error {
+		return g.registerPlayer(name)
+	})
+}
+
+func (g *Game) registerPlayer(name string) error {
+	// unnamed players left after this one registers
 	unnamedCount := 0
 	var err error
-	registeredPlayerCheck := false
 	var emptyPlayer *Player
 
 	for _, player := range g.Players {
 		if player.Name == "" {
-			if !registeredPlayerCheck {
-				registeredPlayerCheck = true
+			if emptyPlayer == nil {
 				emptyPlayer = player
 				continue
 			}
@@ -407,7 +473,7 @@ func (g *Game) RegisterPlayer(name string) error {
 		}
 	}
 
-	if unnamedCount == 0 || emptyPlayer == nil {
+	if emptyPlayer == nil {
 		return errors.New("No more available players to register")
 	}
 
@@ -416,18 +482,34 @@ func (g *Game) RegisterPlayer(name string) error {
 	if err != nil {
 		return err
 	}
-	_, err = emptyPlayer.Update()
+	err = emptyPlayer.generateSecret()
+	if err != nil {
+		return err
+	}
+	g.sendToPlayer(emptyPlayer.PlayerID, "Role", emptyPlayer.Role().Name())
+	err = g.db().UpdatePlayer(emptyPlayer)
+	if err != nil {
+		return err
+	}
+	err = g.record(EventRegistered, PlayerData{PlayerID: emptyPlayer.PlayerID, Name: name})
+	if err != nil {
+		return err
+	}
+	err = g.recordRole(emptyPlayer)
 	if err != nil {
 		return err
 	}
 
 	// If all players have registered, start game
 	if unnamedCount == 0 {
-		g.ProgressStage()
+		err = g.progressStage()
+		if err != nil {
+			return err
+		}
 	}
 
 	g.Modified = time.Now().UTC()
-	_, err = g.Update()
+	err = g.Update()
 	if err != nil {
 		return err
 	}
@@ -435,171 +517,197 @@ func (g *Game) RegisterPlayer(name string) error {
 
 }
 
+// picks a random role out of the roles that have not been dealt yet
 func (g *Game) GenerateRole() (uint, error) {
-
-	roleCounts := make([]uint, 5)
-	// 0 is how many players are generated
-	// 1 is villager
-	// 2 is mafia
-	// 3 is doctor
-	// 4 is sherriff
+	// how many players have been dealt each role
+	dealtCounts := make(map[uint]uint)
+	var dealt uint
 
 	for _, player := range g.Players {
 		if player.role == 0 {
 			continue
-		} else {
-			roleCounts[0] += 1
-			roleCounts[player.role] += 1
 		}
+		dealt += 1
+		dealtCounts[player.role] += 1
 	}
 
-	roleCounts[0] = g.Options.PlayerCount - roleCounts[0]
-	roleCounts[1] = g.Options.VillagerCount() - roleCounts[1]
-	roleCounts[2] = g.Options.MafiaCount - roleCounts[2]
-	roleCounts[3] = g.Options.DoctorCount - roleCounts[3]
-	roleCounts[4] = g.Options.SherriffCount - roleCounts[4]
+	if dealt >= g.Options.PlayerCount {
+		return 0, errors.New("No new roles to be generated")
+	}
 
-	// 0 is how many players are left to be assigned roles
-	// 1 is villagers left to be assigned roles
-	// 2 is mafias left to be assigned roles
-	// 3 is doctors left to be assigned roles
-	// 4 is sherriffs left to be assigned roles
+	roles := Roles()
 
-	if roleCounts[0] <= 0 {
+	// how many of each role are left to be dealt
+	leftCounts := make([]uint, len(roles))
+	var left uint
+	for i, role := range roles {
+		count := role.Count(&g.Options)
+		if count > dealtCounts[role.ID()] {
+			leftCounts[i] = count - dealtCounts[role.ID()]
+			left += leftCounts[i]
+		}
+	}
+
+	if left == 0 {
 		return 0, errors.New("No new roles to be generated")
 	}
 
-	randRole := uint(rand.Intn(int(roleCounts[0])))
-	for i, roleCount := range roleCounts {
-		if i == 0 {
-			continue // ignore the first index
+	randRole := uint(rand.Intn(int(left)))
+	for i, leftCount := range leftCounts {
+		if randRole < leftCount {
+			return roles[i].ID(), nil
 		}
-		if randRole < roleCount {
-			return uint(i), nil
-		}
-		randRole -= roleCount
+		randRole -= leftCount
 	}
 
-	return 1, errors.New("Shouldn't really get here tbh")
+	return VillagerRole, errors.New("Shouldn't really get here tbh")
 }
 
 // kills necessary people and moves stage to next
+// everything the stage change writes commits together
 func (g *Game) ProgressStage() error {
+	return g.transact(func(g *Game) error {
+		return g.progressStage()
+	})
+}
+
+func (g *Game) progressStage() error {
 	var ret int
 	var err error
 	if g.Stage == -1 { // start of game
 		g.Stage = 1
-		g.StageFinish = time.Now().Add(time.Duration(g.Options.NightTimeIntervals) * 15 * time.Second)
+		g.StageFinish = stageDeadline(g.Options.NightTimeIntervals)
 	} else if g.Stage == 1 { // night
 		ret, err = g.processNight()
 		log.Println("Night returned", ret)
 		if err != nil {
 			return err
 		}
+	} else if g.Stage == 2 && g.hasTrials() { // day of nominations
+		ret, err = g.processNominations()
+		log.Println("Nominations returned", ret)
+		if err != nil {
+			return err
+		}
 	} else if g.Stage == 2 { // day
 		ret, err = g.processDay()
 		log.Println("Day returned", ret)
 		if err != nil {
 			return err
 		}
+	} else if g.Stage == DefenseStage {
+		g.processDefense()
+	} else if g.Stage == JudgmentStage {
+		ret, err = g.processJudgment()
+		log.Println("Judgment returned", ret)
+		if err != nil {
+			return err
+		}
+	} else if g.Stage == LastWordsStage {
+		g.processLastWords()
 	}
 
 	g.TurnCount += 1
 
-	if g.CheckFinish() {
-		err = ws.BroadcastEvent(g.GameID, "Victory", g.Stage)
-		if err != nil {
-			log.Println(err)
+	won, err := g.finishIfWon()
+	if err != nil {
+		return err
+	}
+	if !won {
+		g.broadcastEvent("Turn", g.TurnCount)
+
+		// a paused game keeps its new timer paused until the moderator resumes it
+		if g.Paused && !g.StageFinish.IsZero() {
+			g.PauseRemaining = uint(time.Until(g.StageFinish) / time.Second)
+			g.StageFinish = time.Time{}
 		}
-	} else {
 
-		err = ws.BroadcastEvent(g.GameID, "Turn", g.TurnCount)
+		err = g.record(EventStage, g.stageData())
 		if err != nil {
-			log.Println(err)
+			return err
 		}
 	}
 
-	_, err = g.Update()
+	err = g.Update()
 	if err != nil {
 		return err
 	}
 
+	g.reschedule()
+
 	return nil
 }
 
+// moves to the victory stage if a team has won
+// returns whether the game is over
+func (g *Game) finishIfWon() (bool, error) {
+	lastWords := g.Stage == LastWordsStage
+	if !g.CheckFinish() {
+		return false, nil
+	}
+	if lastWords {
+		g.skipLastWords()
+	}
+	g.StageFinish = time.Time{}
+	g.Paused = false
+	g.PauseRemaining = 0
+	err := g.record(EventVictory, g.stageData())
+	if err != nil {
+		return false, err
+	}
+	g.broadcastEvent("Victory", g.Result)
+	g.finishHub()
+	return true, nil
+}
+
+// records the role a player was dealt
+func (g *Game) recordRole(p *Player) error {
+	return g.record(EventRoleDealt, RoleData{p.PlayerID, p.role, p.Role().Name()})
+}
+
+// updates the scheduler with the game's deadline once the game commits
+func (g *Game) reschedule() {
+	gameID, stageFinish := g.GameID, g.StageFinish
+	g.afterCommit(func() {
+		scheduleGame(gameID, stageFinish)
+	})
+}
+
 func (g *Game) processNight() (int, error) {
 	var returnCode int = 0
 
-	moves, err := GetGameTurnMoves(g.GameID, g.TurnCount)
+	moves, err := g.db().GetMoves(g.GameID, MoveFilter{TurnCount: g.TurnCount})
 	if err != nil {
 		return returnCode, err
 	}
-	doctorVoteCounts := make(map[uint]uint)
-	mafiaVoteCounts := make(map[uint]uint)
-	for _, move := range moves {
-		player, err := g.FindPlayerWithID(move.PlayerID)
-		if err != nil {
-			return returnCode, err
-		}
-		if player.role != move.Type { // bad move by player
-			continue
-		}
-		if move.Type == 2 {
-			// mafia
-			if _, ok := mafiaVoteCounts[move.TargetID]; !ok {
-				mafiaVoteCounts[move.TargetID] = 0
-			}
-			mafiaVoteCounts[move.TargetID] += 1
-		}
 
-		if move.Type == 3 {
-			// doctor
-			if _, ok := doctorVoteCounts[move.TargetID]; !ok {
-				doctorVoteCounts[move.TargetID] = 0
-			}
-			doctorVoteCounts[move.TargetID] += 1
-		}
+	night, err := ResolveNight(g, moves)
+	if err != nil {
+		return returnCode, err
 	}
 
-	var mafiaMajorityTarget uint
-	var mafiaMajorityCount uint
-
-	for target, count := range mafiaVoteCounts {
-		if count > mafiaMajorityCount {
-			mafiaMajorityCount = count
-			mafiaMajorityTarget = target
+	for _, p := range night.Deaths {
+		err = g.killPlayer(p, DeathNight, night.Reveal(p))
+		if err != nil {
+			return returnCode, err
 		}
+		g.announceDeath(p, DeathNight)
 	}
+	g.nightResults = night.Results
 
-	var doctorMajorityTarget uint
-	var doctorMajorityCount uint
-
-	for target, count := range doctorVoteCounts {
-		if count > doctorMajorityCount {
-			doctorMajorityCount = count
-			doctorMajorityTarget = target
-		}
+	// results are private, so each player only gets their own
+	for playerID, results := range night.Results {
+		g.sendToPlayer(playerID, "NightResults", results)
 	}
 
-	if mafiaMajorityTarget != doctorMajorityTarget {
-		p, err := g.FindPlayerWithID(mafiaMajorityTarget)
-		if err != nil {
-			return returnCode, err
-		}
-		p.Alive = false
-		_, err = p.Update()
-		if err != nil {
-			return returnCode, err
-		}
-
-		returnCode = 1 // 1 for successful mafia kill
+	if len(night.Deaths) > 0 {
+		returnCode = 1 // 1 for successful kill
 	} else {
-
-		returnCode = 2 // 2 for doctor save
+		returnCode = 2 // 2 for nobody dying
 	}
 
 	g.Stage = 2
-	g.StageFinish = time.Now().Add(time.Duration(g.Options.DayTimeIntervals) * 15 * time.Second)
+	g.StageFinish = stageDeadline(g.Options.DayTimeIntervals)
 
 	return returnCode, nil
 }
@@ -607,49 +715,29 @@ func (g *Game) processNight() (int, error) {
 func (g *Game) processDay() (int, error) {
 	var returnCode int = 0
 
-	moves, err := GetGameTurnMoves(g.GameID, g.TurnCount)
+	moves, err := g.db().GetMoves(g.GameID, MoveFilter{TurnCount: g.TurnCount})
 	if err != nil {
 		return returnCode, err
 	}
-	lynchVoteCounts := make(map[uint]uint)
-	for _, move := range moves {
-		if move.Type == 0 {
-			// lynch
-			if _, ok := lynchVoteCounts[move.TargetID]; !ok {
-				lynchVoteCounts[move.TargetID] = 0
-			}
-			lynchVoteCounts[move.TargetID] += 1
-		}
-
-	}
 
-	var lynchMajorityTarget uint
-	var lynchMajorityCount uint
-	lynchMajorityAchieved := true
+	tally := TallyVotes(g.Options.VotingSystem, moves, g.livingCount(), g.Runoff, g.voteSeed())
+	log.Println(tally.Counts)
 
-	log.Println(lynchVoteCounts)
-
-	for target, count := range lynchVoteCounts {
-		if count > lynchMajorityCount {
-			lynchMajorityCount = count
-			lynchMajorityTarget = target
-			lynchMajorityAchieved = true
-		}
-		if count == lynchMajorityCount {
-			lynchMajorityAchieved = false
-		}
+	if len(tally.Runoff) != 0 {
+		// the day goes on with a new vote between the top targets
+		g.Runoff = tally.Runoff
+		g.StageFinish = stageDeadline(g.Options.DayTimeIntervals)
+		g.broadcastEvent("Runoff", g.Runoff)
+		return 4, nil // 4 for a runoff
 	}
+	g.Runoff = nil
 
-	log.Println(lynchMajorityTarget)
-	if !lynchMajorityAchieved {
+	var lynched *Player
+	log.Println(tally.TargetID)
+	if !tally.Decided {
 		returnCode = 2 // 2 for no majority
-	} else if lynchMajorityTarget != 0 {
-		p, err := g.FindPlayerWithID(lynchMajorityTarget)
-		if err != nil {
-			return returnCode, err
-		}
-		p.Alive = false
-		_, err = p.Update()
+	} else if tally.TargetID != 0 {
+		lynched, err = g.lynch(tally.TargetID)
 		if err != nil {
 			return returnCode, err
 		}
@@ -658,34 +746,35 @@ func (g *Game) processDay() (int, error) {
 		returnCode = 3 // 3 for no kill
 	}
 
-	g.Stage = 1
-	g.StageFinish = time.Now().Add(time.Duration(g.Options.NightTimeIntervals) * 15 * time.Second)
+	g.endDay(lynched)
 
 	return returnCode, nil
 }
 
-func (g *Game) CheckFinish() bool {
-	mafiaWin := true
-	townWin := true
-	for _, player := range g.Players {
-
-		if player.role == 2 {
-			// if any mafia alive, town has not won yet
-			townWin = false
-		} else {
-			// if anyone but mafia alive, mafia has not won yet
-			mafiaWin = false
-		}
-	}
-	if townWin {
-		g.Stage = 11
+// kills the player the day decided on
+func (g *Game) lynch(playerID uint) (*Player, error) {
+	p, err := g.FindPlayerWithID(playerID)
+	if err != nil {
+		return nil, err
 	}
+	return p, g.killPlayer(p, DeathLynch, g.Options.DeathReveal)
+}
 
-	if mafiaWin {
-		g.Stage = 12
+// checks every player's win condition and moves to the stage of the result if the game is over
+func (g *Game) CheckFinish() bool {
+	result := g.decideResult()
+	if result == nil {
+		return false
 	}
+	g.Stage = result.Stage
+	g.Result = result
+	return true
+}
 
-	return townWin || mafiaWin
+// Gets what a player learned from the last night processed by this Game
+// results are not stored, so they are only there right after the night ends
+func (g *Game) NightResults(playerID uint) []NightResult {
+	return g.nightResults[playerID]
 }
 
 func (g *Game) FindPlayerWithID(playerID uint) (*Player, error) {
@@ -708,7 +797,8 @@ func (g *Game) PlayerMap() map[string]uint {
 	return playerMap
 }
 
-func (g *Game) NamesToPlayerIDRoles(playerNames []string) map[string]PlayerIDRole {
+// gets the session of every named player so their device can act as them
+func (g *Game) NamesToPlayerSessions(playerNames []string) map[string]PlayerSession {
 	allPlayerMap := make(map[string]*Player)
 	for _, player := range g.Players {
 		if player == nil || player.Name == "" {
@@ -717,40 +807,69 @@ func (g *Game) NamesToPlayerIDRoles(playerNames []string) map[string]PlayerIDRol
 		allPlayerMap[player.Name] = player
 	}
 
-	retPlayerMap := make(map[string]PlayerIDRole)
+	retPlayerMap := make(map[string]PlayerSession)
 	for _, playerName := range playerNames {
-		retPlayerMap[playerName] = allPlayerMap[playerName].PlayerIDRole()
+		if player, ok := allPlayerMap[playerName]; ok {
+			retPlayerMap[playerName] = player.Session()
+		}
 	}
 	return retPlayerMap
 
 }
 
-// Returns all games
-func GetAllGames() ([]uint, error) {
-	err := db.Db.Ping()
+// Finds a player and checks that the secret is theirs
+func (g *Game) AuthenticatePlayer(playerID uint, secret string) (*Player, error) {
+	p, err := g.FindPlayerWithID(playerID)
 	if err != nil {
 		return nil, err
 	}
+	if !p.CheckSecret(secret) {
+		return nil, ErrBadSecret
+	}
+	return p, nil
+}
 
-	games := make([]uint, 0)
+// RoleInfo is what a player is told about their own role
+type RoleInfo struct {
+	PlayerID uint
+	RoleID   uint
+	Role     string
+	Team     string
+	// roles of other players this player knows about, like mafia teammates
+	KnownRoles map[uint]string
+}
 
-	rows, err := db.Db.Query("SELECT gameid FROM games ORDER BY modified DESC")
-	if rows != nil {
-		defer rows.Close()
-	}
+// Gets what a player knows about roles in the game
+func (g *Game) GetRoleInfo(playerID uint) (*RoleInfo, error) {
+	p, err := g.FindPlayerWithID(playerID)
 	if err != nil {
 		return nil, err
 	}
-	for rows.Next() {
-		var gameID uint
-		if err := rows.Scan(&gameID); err != nil {
-			return nil, err
-		}
-		games = append(games, gameID)
+	role := p.Role()
+	if role == nil {
+		return nil, errors.New("Player has not been dealt a role")
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+
+	info := RoleInfo{
+		PlayerID:   p.PlayerID,
+		RoleID:     role.ID(),
+		Role:       role.Name(),
+		Team:       role.Team().Name,
+		KnownRoles: make(map[uint]string),
 	}
+	for _, other := range g.Players {
+		otherRole := other.Role()
+		if other.PlayerID == p.PlayerID || otherRole == nil {
+			continue
+		}
+		if role.KnowsRole(otherRole) {
+			info.KnownRoles[other.PlayerID] = otherRole.Name()
+		}
+	}
+	return &info, nil
+}
 
-	return games, nil
+// Returns all games
+func GetAllGames() ([]uint, error) {
+	return store.GetAllGames()
 }
@@ -0,0 +1,52 @@
+package game
+
+import "testing"
+
+func TestGameOptionsRoundTrip(t *testing.T) {
+	options := GameOptions{
+		PlayerCount:        20,
+		MafiaCount:         3,
+		DoctorCount:        2,
+		DayTimeIntervals:   30,
+		VotingSystem:       RunoffVoting,
+		DeathReveal:        1,
+		JesterCount:        2,
+		VigilanteCount:     3,
+		ConsortCount:       2,
+		LastWordsIntervals: 4,
+	}
+
+	encoded, err := options.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := DecodeGameOptions(encoded)
+	if err != nil {
+		t.Fatalf("DecodeGameOptions failed: %v", err)
+	}
+	if *decoded != options {
+		t.Errorf("got %+v, want %+v", *decoded, options)
+	}
+}
+
+func TestGameOptionsVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		options GameOptions
+		ok      bool
+	}{
+		{"roles fill every seat", GameOptions{PlayerCount: 6, MafiaCount: 2, DoctorCount: 1, SherriffCount: 1, JesterCount: 2}, true},
+		{"more roles than players", GameOptions{PlayerCount: 6, MafiaCount: 2, DoctorCount: 1, SherriffCount: 1, JesterCount: 3}, false},
+		{"too many players", GameOptions{PlayerCount: MaxPlayers + 1}, false},
+		{"nomination seconds out of range", GameOptions{PlayerCount: 5, NominationSeconds: 8}, false},
+		{"unknown voting system", GameOptions{PlayerCount: 5, VotingSystem: uint(len(VotingSystemNames))}, false},
+		{"trials with a runoff", GameOptions{PlayerCount: 5, Trials: 1, VotingSystem: RunoffVoting}, false},
+	}
+
+	for _, test := range tests {
+		err := test.options.Verify()
+		if (err == nil) != test.ok {
+			t.Errorf("%s: Verify returned %v", test.name, err)
+		}
+	}
+}
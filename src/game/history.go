@@ -0,0 +1,313 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GameEvent is one change to a game, kept in the order it happened
+// a game's events are only ever appended to, so folding them rebuilds the game
+type GameEvent struct {
+	GameID uint
+	Seq    uint // starts at 1 for each game
+	Type   string
+	Data   json.RawMessage
+	Time   time.Time
+}
+
+// types of game events
+const (
+	EventCreated    = "Created"    // CreatedData
+	EventJoined     = "Joined"     // PlayerData, a player joined the lobby
+	EventRegistered = "Registered" // PlayerData, a seat made with the game got a name
+	EventLeft       = "Left"       // PlayerData
+	EventRenamed    = "Renamed"    // PlayerData
+	EventSwapped    = "Swapped"    // PlayerData, someone new took over the seat
+	EventReady      = "Ready"      // PlayerData
+	EventStarted    = "Started"    // StartedData, the lobby closed
+	EventRoleDealt  = "RoleDealt"  // RoleData
+	EventMove       = "Move"       // MoveData
+	EventDied       = "Died"       // PlayerData with the Cause
+	EventRevived    = "Revived"    // PlayerData
+	EventStage      = "Stage"      // StageData
+	EventPaused     = "Paused"     // StageData
+	EventResumed    = "Resumed"    // StageData
+	EventVictory    = "Victory"    // StageData, the game is over
+	EventWill       = "Will"       // PlayerData with the Text of the will
+	EventLastWords  = "LastWords"  // PlayerData with the Text of the last words
+)
+
+// causes of death
+const (
+	DeathNight     = "Night"
+	DeathLynch     = "Lynch"
+	DeathModerator = "Moderator"
+)
+
+// CreatedData is the game as it was made
+// PlayerIDs are the empty seats made with it, lobbies start with none
+type CreatedData struct {
+	Options   GameOptions
+	JoinCode  string `json:",omitempty"`
+	PlayerIDs []uint
+}
+
+// PlayerData is a change to one player
+type PlayerData struct {
+	PlayerID uint
+	Name     string `json:",omitempty"`
+	Ready    bool   `json:",omitempty"`
+	Cause    string `json:",omitempty"`
+	Text     string `json:",omitempty"`
+	Reveal   uint   `json:",omitempty"`
+}
+
+// StartedData is the options a lobby started with
+type StartedData struct {
+	Options GameOptions
+}
+
+// RoleData is a role dealt to a player
+type RoleData struct {
+	PlayerID uint
+	RoleID   uint
+	Role     string
+}
+
+// MoveData is a move made or changed
+// Changed is set when it replaced the player's earlier move that turn
+type MoveData struct {
+	TurnCount uint
+	PlayerID  uint
+	TargetID  uint
+	Type      uint
+	Changed   bool `json:",omitempty"`
+}
+
+// StageData is where the game's stage and timer are after a change
+type StageData struct {
+	Stage          int
+	TurnCount      uint
+	StageFinish    time.Time
+	Paused         bool
+	PauseRemaining uint
+	Runoff         []uint      `json:",omitempty"`
+	Accused        uint        `json:",omitempty"`
+	Result         *GameResult `json:",omitempty"`
+}
+
+var ErrNoHistory = errors.New("Game has no recorded history")
+
+// appends an event to a game's history
+func recordEvent(s Store, gameID uint, eventType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.InsertGameEvent(&GameEvent{
+		GameID: gameID,
+		Type:   eventType,
+		Data:   encoded,
+		Time:   time.Now().UTC(),
+	})
+}
+
+// appends an event to the game's history in the game's transaction
+func (g *Game) record(eventType string, data interface{}) error {
+	return recordEvent(g.db(), g.GameID, eventType, data)
+}
+
+// records the game as it was just made
+func recordCreated(s Store, g *Game) error {
+	playerIDs := make([]uint, 0, len(g.Players))
+	for _, p := range g.Players {
+		playerIDs = append(playerIDs, p.PlayerID)
+	}
+	return recordEvent(s, g.GameID, EventCreated, CreatedData{g.Options, g.JoinCode, playerIDs})
+}
+
+// gets where the game's stage and timer are now
+func (g *Game) stageData() StageData {
+	return StageData{g.Stage, g.TurnCount, g.StageFinish, g.Paused, g.PauseRemaining, g.Runoff, g.Accused, g.Result}
+}
+
+// Gets every event in the game's history, oldest first
+func (g *Game) History() ([]*GameEvent, error) {
+	return g.db().GetGameEvents(g.GameID)
+}
+
+// Rebuilds the game from its history as it was right after the event seq
+// 0 rebuilds it with every event
+// secrets are never recorded, so the rebuilt game has none
+func (g *Game) Rebuild(seq uint) (*Game, error) {
+	events, err := g.History()
+	if err != nil {
+		return nil, err
+	}
+	if seq != 0 {
+		for i, e := range events {
+			if e.Seq > seq {
+				events = events[:i]
+				break
+			}
+		}
+	}
+	return RebuildGame(g.GameID, events)
+}
+
+// Folds a game's events, oldest first, into the game they describe
+func RebuildGame(gameID uint, events []*GameEvent) (*Game, error) {
+	if len(events) == 0 || events[0].Type != EventCreated {
+		return nil, ErrNoHistory
+	}
+
+	g := Game{GameID: gameID, Players: make(Players, 0), Moves: make(Moves, 0)}
+	for _, e := range events {
+		err := g.apply(e)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s in applying event %d (%s)", err.Error(), e.Seq, e.Type))
+		}
+	}
+
+	sort.Sort(g.Players)
+	sort.Sort(g.Moves)
+	return &g, nil
+}
+
+// changes the game by one event
+func (g *Game) apply(e *GameEvent) error {
+	var err error
+	switch e.Type {
+	case EventCreated:
+		var data CreatedData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		g.Stage = -1
+		g.Started = e.Time
+		g.Options = data.Options
+		g.JoinCode = data.JoinCode
+		for _, playerID := range data.PlayerIDs {
+			g.Players = append(g.Players, &Player{GameID: g.GameID, PlayerID: playerID, Alive: true})
+		}
+
+	case EventJoined:
+		var data PlayerData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		g.Players = append(g.Players, &Player{GameID: g.GameID, PlayerID: data.PlayerID, Name: data.Name, Alive: true})
+
+	case EventLeft:
+		var data PlayerData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		p, err := g.FindPlayerWithID(data.PlayerID)
+		if err != nil {
+			return err
+		}
+		for i, player := range g.Players {
+			if player == p {
+				g.Players = append(g.Players[:i], g.Players[i+1:]...)
+				break
+			}
+		}
+
+	case EventRegistered, EventRenamed, EventSwapped, EventReady, EventDied, EventRevived, EventWill, EventLastWords:
+		var data PlayerData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		p, err := g.FindPlayerWithID(data.PlayerID)
+		if err != nil {
+			return err
+		}
+		switch e.Type {
+		case EventReady:
+			p.Ready = data.Ready
+		case EventDied:
+			p.Alive = false
+			p.cause = data.Cause
+			p.reveal = data.Reveal
+		case EventRevived:
+			p.Alive = true
+			p.cause = ""
+		case EventWill:
+			p.will = data.Text
+		case EventLastWords:
+			p.LastWords = data.Text
+		default:
+			p.Name = data.Name
+		}
+
+	case EventStarted:
+		var data StartedData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		g.Options = data.Options
+		g.JoinCode = ""
+
+	case EventRoleDealt:
+		var data RoleData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		p, err := g.FindPlayerWithID(data.PlayerID)
+		if err != nil {
+			return err
+		}
+		p.role = data.RoleID
+
+	case EventMove:
+		var data MoveData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		g.applyMove(data, e.Time)
+
+	case EventStage, EventPaused, EventResumed, EventVictory:
+		var data StageData
+		if err = json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		g.Stage = data.Stage
+		g.TurnCount = data.TurnCount
+		g.StageFinish = data.StageFinish
+		g.Paused = data.Paused
+		g.PauseRemaining = data.PauseRemaining
+		g.Runoff = data.Runoff
+		g.Accused = data.Accused
+		g.Result = data.Result
+
+	default:
+		return errors.New(fmt.Sprintf("Unknown event type %s", e.Type))
+	}
+
+	g.Modified = e.Time
+	return nil
+}
+
+// sets the player's move for the turn, replacing the one they already made
+func (g *Game) applyMove(data MoveData, t time.Time) {
+	for _, m := range g.Moves {
+		if m.PlayerID == data.PlayerID && m.TurnCount == data.TurnCount {
+			m.TargetID = data.TargetID
+			m.Type = data.Type
+			m.Time = t
+			return
+		}
+	}
+	g.Moves = append(g.Moves, &Move{
+		GameID:    g.GameID,
+		TurnCount: data.TurnCount,
+		PlayerID:  data.PlayerID,
+		TargetID:  data.TargetID,
+		Type:      data.Type,
+		Time:      t,
+	})
+}
@@ -0,0 +1,304 @@
+package game
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// join codes leave out letters and digits that are easy to mix up, like O and 0
+const joinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const joinCodeLength = 6
+
+// longest name a player can pick, matches the players table
+const maxNameLength = 64
+
+var ErrNotLobby = errors.New("Game is not an open lobby")
+
+// LobbyEvent is broadcast on the game's hub whenever the lobby's membership changes
+type LobbyEvent struct {
+	Action   string
+	PlayerID uint
+	Name     string
+	Ready    bool
+}
+
+// makes a random join code
+func generateJoinCode() (string, error) {
+	code := make([]byte, joinCodeLength)
+	max := big.NewInt(int64(len(joinCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = joinCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// makes a join code no open lobby is using
+func getUniqueJoinCode(s Store) (string, error) {
+	for {
+		code, err := generateJoinCode()
+		if err != nil {
+			return "", err
+		}
+		_, err = s.GetJoinCodeGame(code)
+		if err == ErrGameNotFound {
+			return code, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// Creates a game with an open lobby and no players
+// the options are picked when the host starts the game
+func MakeLobby() (*Game, error) {
+	var g *Game
+	err := store.Transact(func(tx Store) error {
+		var err error
+		g, err = makeGame(tx, GameOptions{})
+		if err != nil {
+			return err
+		}
+		g.JoinCode, err = getUniqueJoinCode(tx)
+		if err != nil {
+			return err
+		}
+		err = tx.UpdateGame(g)
+		if err != nil {
+			return err
+		}
+		return recordCreated(tx, g)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Gets the game with an open lobby using the join code
+// codes are not case sensitive
+func GetLobbyGame(joinCode string) (*Game, error) {
+	gameID, err := store.GetJoinCodeGame(strings.ToUpper(joinCode))
+	if err != nil {
+		return nil, err
+	}
+	return GetGame(gameID)
+}
+
+// whether players can still join, leave and get ready
+func (g *Game) IsLobby() bool {
+	return g.Stage == -1 && g.JoinCode != ""
+}
+
+// checks a name can be used by a player in the lobby
+func (g *Game) checkName(name string) error {
+	if name == "" {
+		return errors.New("Name cannot be empty")
+	}
+	if len(name) > maxNameLength {
+		return errors.New(fmt.Sprintf("Name cannot be longer than %d characters", maxNameLength))
+	}
+	for _, player := range g.Players {
+		if player.Name == name {
+			return errors.New("Cannot have two players with the same name")
+		}
+	}
+	return nil
+}
+
+// finds a player in the lobby
+func (g *Game) lobbyPlayer(playerID uint) (*Player, error) {
+	if !g.IsLobby() {
+		return nil, ErrNotLobby
+	}
+	return g.FindPlayerWithID(playerID)
+}
+
+// Adds a new player to the lobby and returns their session
+func (g *Game) JoinLobby(name string) (PlayerSession, error) {
+	var session PlayerSession
+	err := g.transact(func(g *Game) error {
+		if !g.IsLobby() {
+			return ErrNotLobby
+		}
+		if uint(len(g.Players)) >= MaxPlayers {
+			return errors.New("Lobby is full")
+		}
+		err := g.checkName(name)
+		if err != nil {
+			return err
+		}
+
+		p, err := makePlayer(g.db(), g.GameID)
+		if err != nil {
+			return err
+		}
+		p.Name = name
+		err = p.generateSecret()
+		if err != nil {
+			return err
+		}
+		err = g.db().UpdatePlayer(p)
+		if err != nil {
+			return err
+		}
+		err = g.record(EventJoined, PlayerData{PlayerID: p.PlayerID, Name: p.Name})
+		if err != nil {
+			return err
+		}
+		g.Players = append(g.Players, p)
+		session = p.Session()
+
+		g.broadcastEvent("Lobby", LobbyEvent{"Join", p.PlayerID, p.Name, p.Ready})
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+	return session, err
+}
+
+// Removes a player from the lobby and closes their connections
+func (g *Game) LeaveLobby(playerID uint) error {
+	return g.transact(func(g *Game) error {
+		p, err := g.lobbyPlayer(playerID)
+		if err != nil {
+			return err
+		}
+
+		err = g.db().DeletePlayer(p)
+		if err != nil {
+			return err
+		}
+		err = g.record(EventLeft, PlayerData{PlayerID: p.PlayerID})
+		if err != nil {
+			return err
+		}
+		for i, player := range g.Players {
+			if player == p {
+				g.Players = append(g.Players[:i], g.Players[i+1:]...)
+				break
+			}
+		}
+
+		g.broadcastEvent("Lobby", LobbyEvent{"Leave", p.PlayerID, p.Name, false})
+		g.dropPlayer(p.PlayerID)
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+}
+
+// Changes the name a player goes by in the lobby
+func (g *Game) RenamePlayer(playerID uint, name string) error {
+	return g.transact(func(g *Game) error {
+		p, err := g.lobbyPlayer(playerID)
+		if err != nil {
+			return err
+		}
+		if p.Name == name {
+			return nil
+		}
+		err = g.checkName(name)
+		if err != nil {
+			return err
+		}
+
+		p.Name = name
+		err = g.db().UpdatePlayer(p)
+		if err != nil {
+			return err
+		}
+		err = g.record(EventRenamed, PlayerData{PlayerID: p.PlayerID, Name: name})
+		if err != nil {
+			return err
+		}
+
+		g.broadcastEvent("Lobby", LobbyEvent{"Rename", p.PlayerID, p.Name, p.Ready})
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+}
+
+// Marks whether a player is ready for the game to start
+func (g *Game) SetReady(playerID uint, ready bool) error {
+	return g.transact(func(g *Game) error {
+		p, err := g.lobbyPlayer(playerID)
+		if err != nil {
+			return err
+		}
+
+		p.Ready = ready
+		err = g.db().UpdatePlayer(p)
+		if err != nil {
+			return err
+		}
+		err = g.record(EventReady, PlayerData{PlayerID: p.PlayerID, Ready: ready})
+		if err != nil {
+			return err
+		}
+
+		g.broadcastEvent("Lobby", LobbyEvent{"Ready", p.PlayerID, p.Name, p.Ready})
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+}
+
+// Closes the lobby, deals roles with the options and starts the first night
+// PlayerCount is set to the number of players in the lobby, who all have to be ready
+func (g *Game) StartLobby(options GameOptions) error {
+	return g.transact(func(g *Game) error {
+		if !g.IsLobby() {
+			return ErrNotLobby
+		}
+		if len(g.Players) == 0 {
+			return errors.New("Nobody has joined the lobby")
+		}
+		for _, player := range g.Players {
+			if !player.Ready {
+				return errors.New(fmt.Sprintf("%s is not ready", player.Name))
+			}
+		}
+
+		options.PlayerCount = uint(len(g.Players))
+		err := options.Verify()
+		if err != nil {
+			return err
+		}
+		g.Options = options
+		g.JoinCode = ""
+		err = g.record(EventStarted, StartedData{options})
+		if err != nil {
+			return err
+		}
+
+		for _, player := range g.Players {
+			player.role, err = g.GenerateRole()
+			if err != nil {
+				return err
+			}
+			err = g.db().UpdatePlayer(player)
+			if err != nil {
+				return err
+			}
+			err = g.recordRole(player)
+			if err != nil {
+				return err
+			}
+			g.sendToPlayer(player.PlayerID, "Role", player.Role().Name())
+		}
+
+		g.broadcastEvent("Lobby", LobbyEvent{Action: "Start"})
+
+		g.Modified = time.Now().UTC()
+		return g.progressStage()
+	})
+}
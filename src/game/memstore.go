@@ -0,0 +1,529 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store that keeps everything in memory
+// nothing survives a restart, meant for development and tests
+type memoryStore struct {
+	mutex    sync.Mutex
+	games    map[uint]Game
+	players  map[uint]Player
+	moves    []Move
+	chat     []ChatMessage
+	history  []GameEvent
+	counters map[string]*memoryCounter
+	chatID   uint // ID of the last chat message, never rolled back so that IDs are not reused
+}
+
+type memoryCounter struct {
+	count    uint
+	scale    uint
+	addConst uint
+}
+
+// Makes an empty in-memory store with seeded ID counters
+func NewMemoryStore() Store {
+	return &memoryStore{
+		games:   make(map[uint]Game),
+		players: make(map[uint]Player),
+		moves:   make([]Move, 0),
+		counters: map[string]*memoryCounter{
+			"games":   &memoryCounter{0, 40503, 12345},
+			"players": &memoryCounter{0, 30011, 5051},
+		},
+	}
+}
+
+func (s *memoryStore) Ping() error {
+	return nil
+}
+
+// memoryStore as seen from inside a transaction
+// every write first remembers how to put back what it changed
+type memoryTx struct {
+	*memoryStore
+	undo *[]func() // run newest first with the store locked on a rollback
+}
+
+// joins the transaction that is already running
+func (t memoryTx) Transact(fn func(Store) error) error {
+	return fn(t)
+}
+
+// runs fn and puts back only the rows it wrote if it fails
+// writes made outside of the transaction, like chat, are kept
+// transactions on the same game are already run one at a time by the game's lock,
+// so transactions on different games run side by side
+func (s *memoryStore) Transact(fn func(Store) error) error {
+	undo := make([]func(), 0)
+	err := fn(memoryTx{s, &undo})
+	if err != nil {
+		s.mutex.Lock()
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		s.mutex.Unlock()
+	}
+	return err
+}
+
+func (t memoryTx) remember(fn func()) {
+	*t.undo = append(*t.undo, fn)
+}
+
+// remembers a game row as it is before it is written
+func (t memoryTx) saveGame(gameID uint) {
+	s := t.memoryStore
+	s.mutex.Lock()
+	old, ok := s.games[gameID]
+	s.mutex.Unlock()
+	t.remember(func() {
+		if ok {
+			s.games[gameID] = old
+		} else {
+			delete(s.games, gameID)
+		}
+	})
+}
+
+// remembers a player row as it is before it is written
+func (t memoryTx) savePlayer(playerID uint) {
+	s := t.memoryStore
+	s.mutex.Lock()
+	old, ok := s.players[playerID]
+	s.mutex.Unlock()
+	t.remember(func() {
+		if ok {
+			s.players[playerID] = old
+		} else {
+			delete(s.players, playerID)
+		}
+	})
+}
+
+// gets where a move is in the store, -1 if it is not
+// the store has to be locked
+func (s *memoryStore) moveIndex(m *Move) int {
+	for i, row := range s.moves {
+		if row.GameID == m.GameID && row.PlayerID == m.PlayerID && row.TurnCount == m.TurnCount {
+			return i
+		}
+	}
+	return -1
+}
+
+// remembers a move row as it is before it is written
+func (t memoryTx) saveMove(m *Move) {
+	s := t.memoryStore
+	key := *m
+	s.mutex.Lock()
+	var old Move
+	i := s.moveIndex(&key)
+	if i >= 0 {
+		old = s.moves[i]
+	}
+	s.mutex.Unlock()
+	t.remember(func() {
+		j := s.moveIndex(&key)
+		if i >= 0 && j >= 0 {
+			s.moves[j] = old
+		} else if j >= 0 {
+			s.moves = append(s.moves[:j], s.moves[j+1:]...)
+		}
+	})
+}
+
+func (t memoryTx) SetCounter(key string, count uint) error {
+	s := t.memoryStore
+	old, _, _, err := s.GetCounter(key)
+	if err != nil {
+		return err
+	}
+	t.remember(func() {
+		// another transaction may have moved the counter on since
+		if c := s.counters[key]; c.count == count {
+			c.count = old
+		}
+	})
+	return s.SetCounter(key, count)
+}
+
+func (t memoryTx) InsertGame(g *Game) error {
+	t.saveGame(g.GameID)
+	return t.memoryStore.InsertGame(g)
+}
+
+func (t memoryTx) UpdateGame(g *Game) error {
+	t.saveGame(g.GameID)
+	return t.memoryStore.UpdateGame(g)
+}
+
+func (t memoryTx) InsertPlayer(p *Player) error {
+	t.savePlayer(p.PlayerID)
+	return t.memoryStore.InsertPlayer(p)
+}
+
+func (t memoryTx) UpdatePlayer(p *Player) error {
+	t.savePlayer(p.PlayerID)
+	return t.memoryStore.UpdatePlayer(p)
+}
+
+func (t memoryTx) DeletePlayer(p *Player) error {
+	t.savePlayer(p.PlayerID)
+	return t.memoryStore.DeletePlayer(p)
+}
+
+func (t memoryTx) InsertMove(m *Move) error {
+	t.saveMove(m)
+	return t.memoryStore.InsertMove(m)
+}
+
+func (t memoryTx) UpdateMove(m *Move) error {
+	t.saveMove(m)
+	return t.memoryStore.UpdateMove(m)
+}
+
+func (t memoryTx) InsertChatMessage(m *ChatMessage) error {
+	s := t.memoryStore
+	err := s.InsertChatMessage(m)
+	if err != nil {
+		return err
+	}
+	id := m.ID
+	t.remember(func() {
+		for i, row := range s.chat {
+			if row.ID == id {
+				s.chat = append(s.chat[:i], s.chat[i+1:]...)
+				break
+			}
+		}
+	})
+	return nil
+}
+
+func (t memoryTx) InsertGameEvent(e *GameEvent) error {
+	s := t.memoryStore
+	err := s.InsertGameEvent(e)
+	if err != nil {
+		return err
+	}
+	gameID, seq := e.GameID, e.Seq
+	t.remember(func() {
+		for i, row := range s.history {
+			if row.GameID == gameID && row.Seq == seq {
+				s.history = append(s.history[:i], s.history[i+1:]...)
+				break
+			}
+		}
+	})
+	return nil
+}
+
+func (s *memoryStore) GetCounter(key string) (uint, uint, uint, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok {
+		return 0, 0, 0, errors.New(fmt.Sprintf("No counter with type %s", key))
+	}
+	return c.count, c.scale, c.addConst, nil
+}
+
+func (s *memoryStore) SetCounter(key string, count uint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok {
+		return errors.New(fmt.Sprintf("No counter with type %s", key))
+	}
+	c.count = count
+	return nil
+}
+
+func (s *memoryStore) IDExists(idType string, id uint) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ok bool
+	if strings.Contains(strings.ToLower(idType), "game") {
+		_, ok = s.games[id]
+	} else if strings.Contains(strings.ToLower(idType), "player") {
+		_, ok = s.players[id]
+	} else {
+		return false, errors.New(fmt.Sprintf("Unknown ID type %s", idType))
+	}
+	return ok, nil
+}
+
+// only the game row is stored, players and moves live in their own maps
+func gameRow(g *Game) Game {
+	return Game{
+		GameID:      g.GameID,
+		Stage:       g.Stage,
+		Started:     g.Started,
+		Modified:    g.Modified,
+		StageFinish: g.StageFinish,
+		TurnCount:   g.TurnCount,
+		Options:     g.Options,
+		JoinCode:    g.JoinCode,
+
+		Paused:          g.Paused,
+		PauseRemaining:  g.PauseRemaining,
+		Runoff:          append([]uint(nil), g.Runoff...),
+		Accused:         g.Accused,
+		Result:          g.Result,
+		moderatorSecret: g.moderatorSecret,
+	}
+}
+
+func (s *memoryStore) InsertGame(g *Game) error {
+	if _, err := g.Options.Encode(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.games[g.GameID]; ok {
+		return errors.New(fmt.Sprintf("GameID %d already exists", g.GameID))
+	}
+	s.games[g.GameID] = gameRow(g)
+	return nil
+}
+
+func (s *memoryStore) UpdateGame(g *Game) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old, ok := s.games[g.GameID]
+	if !ok {
+		return nil // matches an UPDATE that hits no rows
+	}
+	if _, err := g.Options.Encode(); err != nil {
+		return err
+	}
+	if g.JoinCode != "" && g.JoinCode != old.JoinCode {
+		for _, row := range s.games {
+			if row.JoinCode == g.JoinCode {
+				return errors.New(fmt.Sprintf("Join code %s already exists", g.JoinCode))
+			}
+		}
+	}
+	row := gameRow(g)
+	// the moderator secret is only set on insert
+	row.moderatorSecret = old.moderatorSecret
+	s.games[g.GameID] = row
+	return nil
+}
+
+func (s *memoryStore) GetGame(gameID uint) (*Game, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	row, ok := s.games[gameID]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	return &row, nil
+}
+
+func (s *memoryStore) GetJoinCodeGame(joinCode string) (uint, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, row := range s.games {
+		if row.JoinCode != "" && row.JoinCode == joinCode {
+			return row.GameID, nil
+		}
+	}
+	return 0, ErrGameNotFound
+}
+
+func (s *memoryStore) GetAllGames() ([]uint, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rows := make([]Game, 0, len(s.games))
+	for _, row := range s.games {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Modified.After(rows[j].Modified)
+	})
+
+	games := make([]uint, len(rows))
+	for i, row := range rows {
+		games[i] = row.GameID
+	}
+	return games, nil
+}
+
+func (s *memoryStore) GetScheduledGames() (map[uint]time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	games := make(map[uint]time.Time)
+	for _, row := range s.games {
+		if !row.StageFinish.IsZero() {
+			games[row.GameID] = row.StageFinish
+		}
+	}
+	return games, nil
+}
+
+func (s *memoryStore) InsertPlayer(p *Player) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.players[p.PlayerID]; ok {
+		return errors.New(fmt.Sprintf("PlayerID %d already exists", p.PlayerID))
+	}
+	s.players[p.PlayerID] = *p
+	return nil
+}
+
+func (s *memoryStore) UpdatePlayer(p *Player) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.players[p.PlayerID]; ok && old.GameID == p.GameID {
+		s.players[p.PlayerID] = *p
+	}
+	return nil
+}
+
+func (s *memoryStore) DeletePlayer(p *Player) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.players[p.PlayerID]; ok && old.GameID == p.GameID {
+		delete(s.players, p.PlayerID)
+	}
+	return nil
+}
+
+func (s *memoryStore) GetGamePlayers(gameID uint) (Players, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	players := make(Players, 0)
+	for _, row := range s.players {
+		if row.GameID == gameID {
+			player := row
+			players = append(players, &player)
+		}
+	}
+
+	sort.Sort(players)
+
+	return players, nil
+}
+
+func (s *memoryStore) InsertMove(m *Move) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.moves = append(s.moves, *m)
+	return nil
+}
+
+func (s *memoryStore) UpdateMove(m *Move) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if i := s.moveIndex(m); i >= 0 {
+		s.moves[i].TargetID = m.TargetID
+		s.moves[i].Type = m.Type
+		s.moves[i].Time = m.Time
+	}
+	return nil
+}
+
+func (s *memoryStore) GetMoves(gameID uint, filter MoveFilter) (Moves, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	moves := make(Moves, 0)
+	for _, row := range s.moves {
+		if row.GameID != gameID {
+			continue
+		}
+		if filter.PlayerID != 0 && row.PlayerID != filter.PlayerID {
+			continue
+		}
+		if filter.TurnCount != 0 && row.TurnCount != filter.TurnCount {
+			continue
+		}
+		move := row
+		moves = append(moves, &move)
+	}
+
+	sort.Sort(moves)
+
+	return moves, nil
+}
+
+func (s *memoryStore) InsertChatMessage(m *ChatMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.chatID += 1
+	m.ID = s.chatID
+	s.chat = append(s.chat, *m)
+	return nil
+}
+
+func (s *memoryStore) GetChatMessages(gameID uint, channel string, before uint, limit int) ([]*ChatMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages := make([]*ChatMessage, 0)
+	for i := len(s.chat) - 1; i >= 0 && len(messages) < limit; i-- {
+		row := s.chat[i]
+		if row.GameID != gameID || row.Channel != channel || (before != 0 && row.ID >= before) {
+			continue
+		}
+		m := row
+		messages = append(messages, &m)
+	}
+	return messages, nil
+}
+
+func (s *memoryStore) InsertGameEvent(e *GameEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var seq uint
+	for _, row := range s.history {
+		if row.GameID == e.GameID && row.Seq > seq {
+			seq = row.Seq
+		}
+	}
+	e.Seq = seq + 1
+	s.history = append(s.history, *e)
+	return nil
+}
+
+func (s *memoryStore) GetGameEvents(gameID uint) ([]*GameEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := make([]*GameEvent, 0)
+	for _, row := range s.history {
+		if row.GameID != gameID {
+			continue
+		}
+		e := row
+		events = append(events, &e)
+	}
+	return events, nil
+}
@@ -0,0 +1,79 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryRollbackKeepsOutsideWrites(t *testing.T) {
+	s := NewMemoryStore()
+	failed := errors.New("failed")
+
+	err := s.Transact(func(tx Store) error {
+		if err := tx.InsertGame(&Game{GameID: 1}); err != nil {
+			return err
+		}
+		if err := tx.InsertChatMessage(&ChatMessage{GameID: 1, Text: "inside"}); err != nil {
+			return err
+		}
+		if err := tx.InsertGameEvent(&GameEvent{GameID: 1, Type: EventCreated}); err != nil {
+			return err
+		}
+		// posted by someone else while the transaction runs
+		if err := s.InsertChatMessage(&ChatMessage{GameID: 1, Text: "outside"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Transact returned %v", err)
+	}
+
+	if _, err := s.GetGame(1); err != ErrGameNotFound {
+		t.Errorf("game was not rolled back: %v", err)
+	}
+	events, _ := s.GetGameEvents(1)
+	if len(events) != 0 {
+		t.Errorf("got %d events after the rollback, want 0", len(events))
+	}
+
+	messages, _ := s.GetChatMessages(1, "", 0, 10)
+	if len(messages) != 1 || messages[0].Text != "outside" {
+		t.Fatalf("got messages %+v, want only the one from outside", messages)
+	}
+
+	next := ChatMessage{GameID: 1, Text: "next"}
+	s.InsertChatMessage(&next)
+	if next.ID <= messages[0].ID {
+		t.Errorf("message ID %d was reused", next.ID)
+	}
+}
+
+func TestMemoryRollbackRestoresRows(t *testing.T) {
+	s := NewMemoryStore()
+	s.InsertGame(&Game{GameID: 1, Stage: 1})
+	s.InsertPlayer(&Player{GameID: 1, PlayerID: 2, Name: "a", Alive: true})
+	s.InsertMove(&Move{GameID: 1, TurnCount: 1, PlayerID: 2, TargetID: 3})
+
+	s.Transact(func(tx Store) error {
+		tx.UpdateGame(&Game{GameID: 1, Stage: 2})
+		tx.UpdatePlayer(&Player{GameID: 1, PlayerID: 2, Name: "a"})
+		tx.InsertPlayer(&Player{GameID: 1, PlayerID: 3, Name: "b"})
+		tx.UpdateMove(&Move{GameID: 1, TurnCount: 1, PlayerID: 2, TargetID: 4})
+		tx.InsertMove(&Move{GameID: 1, TurnCount: 2, PlayerID: 2, TargetID: 5})
+		return errors.New("failed")
+	})
+
+	g, _ := s.GetGame(1)
+	if g.Stage != 1 {
+		t.Errorf("got stage %d, want 1", g.Stage)
+	}
+	players, _ := s.GetGamePlayers(1)
+	if len(players) != 1 || !players[0].Alive {
+		t.Errorf("got players %+v, want the one living player", players)
+	}
+	moves, _ := s.GetMoves(1, MoveFilter{})
+	if len(moves) != 1 || moves[0].TargetID != 3 {
+		t.Errorf("got moves %+v, want the first move unchanged", moves)
+	}
+}
@@ -0,0 +1,262 @@
+package game
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// stage a game is in after the moderator ends it without a winner
+const ModeratorEndedStage = 13
+
+var ErrBadModeratorSecret = errors.New("Secret does not match the game's moderator")
+var ErrGameOver = errors.New("Game is over")
+
+// ModeratorEvent is broadcast on the game's hub for every moderator action
+type ModeratorEvent struct {
+	Action   string
+	PlayerID uint   `json:",omitempty"`
+	Name     string `json:",omitempty"`
+	Stage    int    `json:",omitempty"`
+}
+
+// whether the game has ended, by a team winning or the moderator ending it
+func (g *Game) IsOver() bool {
+	return g.Stage > 10
+}
+
+// Checks a secret against the game's moderator secret
+func (g *Game) CheckModeratorSecret(secret string) error {
+	if g.moderatorSecret == "" || subtle.ConstantTimeCompare([]byte(g.moderatorSecret), []byte(secret)) != 1 {
+		return ErrBadModeratorSecret
+	}
+	return nil
+}
+
+// Gets the moderator secret, only given out when the game is made
+func (g *Game) ModeratorSecret() string {
+	return g.moderatorSecret
+}
+
+// Stops the stage timer until Resume is called
+// the stage still ends early if everyone moves
+func (g *Game) Pause() error {
+	return g.transact(func(g *Game) error {
+		if g.IsOver() {
+			return ErrGameOver
+		}
+		if g.Paused {
+			return errors.New("Game is already paused")
+		}
+
+		g.Paused = true
+		if !g.StageFinish.IsZero() {
+			remaining := time.Until(g.StageFinish)
+			if remaining < 0 {
+				remaining = 0
+			}
+			g.PauseRemaining = uint(remaining / time.Second)
+			g.StageFinish = time.Time{}
+		}
+		err := g.record(EventPaused, g.stageData())
+		if err != nil {
+			return err
+		}
+
+		g.broadcastEvent("Moderator", ModeratorEvent{Action: "Pause"})
+		g.reschedule()
+		return g.Update()
+	})
+}
+
+// Restarts the stage timer with the time that was left when it was paused
+func (g *Game) Resume() error {
+	return g.transact(func(g *Game) error {
+		if !g.Paused {
+			return errors.New("Game is not paused")
+		}
+
+		g.Paused = false
+		if g.PauseRemaining > 0 {
+			g.StageFinish = time.Now().UTC().Add(time.Duration(g.PauseRemaining) * time.Second)
+		} else {
+			g.StageFinish = stageDeadline(g.stageIntervals())
+		}
+		g.PauseRemaining = 0
+		err := g.record(EventResumed, g.stageData())
+		if err != nil {
+			return err
+		}
+
+		g.broadcastEvent("Moderator", ModeratorEvent{Action: "Resume"})
+		g.reschedule()
+		return g.Update()
+	})
+}
+
+// Ends the current stage straight away, whether or not everyone has moved
+func (g *Game) ForceAdvance() error {
+	return g.transact(func(g *Game) error {
+		if g.IsOver() {
+			return ErrGameOver
+		}
+		g.broadcastEvent("Moderator", ModeratorEvent{Action: "Advance"})
+		return g.progressStage()
+	})
+}
+
+// sets whether a player is alive and checks whether that decided the game
+func (g *Game) setAlive(playerID uint, alive bool, action string) error {
+	return g.transact(func(g *Game) error {
+		if g.IsOver() {
+			return ErrGameOver
+		}
+
+		p, err := g.FindPlayerWithID(playerID)
+		if err != nil {
+			return err
+		}
+		if p.Alive == alive {
+			if alive {
+				return errors.New(fmt.Sprintf("PlayerID %d is already alive", playerID))
+			}
+			return errors.New(fmt.Sprintf("PlayerID %d is already dead", playerID))
+		}
+
+		if alive {
+			p.Alive = true
+			p.cause = ""
+			err = g.db().UpdatePlayer(p)
+			if err != nil {
+				return err
+			}
+			err = g.record(EventRevived, PlayerData{PlayerID: playerID})
+		} else {
+			err = g.killPlayer(p, DeathModerator, g.Options.DeathReveal)
+		}
+		if err != nil {
+			return err
+		}
+		g.broadcastEvent("Moderator", ModeratorEvent{Action: action, PlayerID: playerID})
+		if !alive {
+			g.announceDeath(p, DeathModerator)
+		}
+
+		won, err := g.finishIfWon()
+		if err != nil {
+			return err
+		}
+		if won {
+			g.reschedule()
+		}
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+}
+
+// Kills a player outside of the night and day votes
+func (g *Game) KillPlayer(playerID uint) error {
+	return g.setAlive(playerID, false, "Kill")
+}
+
+// Brings a dead player back to life
+func (g *Game) RevivePlayer(playerID uint) error {
+	return g.setAlive(playerID, true, "Revive")
+}
+
+// Gives a player's seat to someone new, who keeps the role and moves
+// the old secret stops working, the old player's connections are closed and the new player's session is returned
+func (g *Game) SwapPlayer(playerID uint, name string) (PlayerSession, error) {
+	var session PlayerSession
+	err := g.transact(func(g *Game) error {
+		if g.IsOver() {
+			return ErrGameOver
+		}
+		if name == "" {
+			return errors.New("Name cannot be empty")
+		}
+
+		p, err := g.FindPlayerWithID(playerID)
+		if err != nil {
+			return err
+		}
+		if p.Name == "" {
+			return errors.New(fmt.Sprintf("PlayerID %d has not registered", playerID))
+		}
+		for _, player := range g.Players {
+			if player.Name == name {
+				return errors.New("Cannot have two players with the same name")
+			}
+		}
+
+		p.Name = name
+		err = p.generateSecret()
+		if err != nil {
+			return err
+		}
+		err = g.db().UpdatePlayer(p)
+		if err != nil {
+			return err
+		}
+		err = g.record(EventSwapped, PlayerData{PlayerID: playerID, Name: name})
+		if err != nil {
+			return err
+		}
+		session = p.Session()
+
+		g.broadcastEvent("Moderator", ModeratorEvent{Action: "Swap", PlayerID: playerID, Name: name})
+		g.dropPlayer(playerID)
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+	return session, err
+}
+
+// Ends the game
+// winner is the name of the team that wins, or empty for nobody
+func (g *Game) EndGame(winner string) error {
+	return g.transact(func(g *Game) error {
+		if g.IsOver() {
+			return ErrGameOver
+		}
+
+		stage := ModeratorEndedStage
+		var team *Team
+		if winner != "" {
+			var err error
+			team, err = GetTeam(winner)
+			if err != nil {
+				return err
+			}
+			if team.VictoryStage == 0 {
+				return errors.New(fmt.Sprintf("%s cannot win on its own", team.Name))
+			}
+			stage = team.VictoryStage
+		}
+
+		if g.Stage == LastWordsStage {
+			g.skipLastWords()
+		}
+		g.Accused = 0
+
+		g.Stage = stage
+		g.Result = g.declareResult(stage, team)
+		g.StageFinish = time.Time{}
+		g.Paused = false
+		g.PauseRemaining = 0
+		err := g.record(EventVictory, g.stageData())
+		if err != nil {
+			return err
+		}
+		g.broadcastEvent("Moderator", ModeratorEvent{Action: "End", Stage: stage})
+		g.broadcastEvent("Victory", g.Result)
+		g.finishHub()
+		g.reschedule()
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+}
@@ -1,9 +1,6 @@
 package game
 
 import (
-	"database/sql"
-	"db"
-	"sort"
 	"time"
 )
 
@@ -31,10 +28,10 @@ func (a Moves) Less(i, j int) bool {
 // Creates a new player and uploads it to the database
 // default player has no name and no role
 func MakeMove(gameID, turnCount, playerID, targetID, moveType uint) (*Move, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
+	return makeMove(store, gameID, turnCount, playerID, targetID, moveType)
+}
+
+func makeMove(s Store, gameID, turnCount, playerID, targetID, moveType uint) (*Move, error) {
 	var m Move
 
 	m.GameID = gameID
@@ -44,7 +41,7 @@ func MakeMove(gameID, turnCount, playerID, targetID, moveType uint) (*Move, erro
 	m.Type = moveType
 	m.Time = time.Now().UTC()
 
-	_, err = m.Upload()
+	err := s.InsertMove(&m)
 
 	if err != nil {
 		return nil, err
@@ -53,35 +50,15 @@ func MakeMove(gameID, turnCount, playerID, targetID, moveType uint) (*Move, erro
 	return &m, nil
 }
 
-// updates database version of the game
-func (m *Move) Update() (sql.Result, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	updateGame, err := db.Db.Prepare("UPDATE moves SET targetid=?, type=?, time=? WHERE gameid=? AND playerid=? AND turncount=?")
-	if err != nil {
-		return nil, err
-	}
+// updates database version of the move
+func (m *Move) Update() error {
 	m.Time = time.Now().UTC()
-
-	return updateGame.Exec(m.TargetID, m.Type, m.Time, m.GameID, m.PlayerID, m.TurnCount)
+	return store.UpdateMove(m)
 }
 
-// updates database version of the game
-func (m *Move) Upload() (sql.Result, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	addGame, err := db.Db.Prepare("INSERT INTO moves (gameid, turncount, playerid, targetid, type, time) VALUES (?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		return nil, err
-	}
-
-	return addGame.Exec(m.GameID, m.TurnCount, m.PlayerID, m.TargetID, m.Type, m.Time)
+// uploads a new move to the database
+func (m *Move) Upload() error {
+	return store.InsertMove(m)
 }
 
 // wrapper function around GetPlayerMoves to get moves for entire game
@@ -93,76 +70,13 @@ func GetGameMoves(gameID uint) (Moves, error) {
 // gets all moves by a player in a specific game
 // sorted by turn count
 func GetPlayerMoves(gameID uint, playerID uint) (Moves, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	var rows *sql.Rows
-
-	// don't check for matching player
-	if playerID == 0 {
-		rows, err = db.Db.Query("SELECT turncount, playerid, targetid, type, time FROM moves WHERE gameid=?", gameID)
-	} else { // actually check for matching player
-		rows, err = db.Db.Query("SELECT turncount, playerid, targetid, type, time FROM moves WHERE gameid=? AND playerid=?", gameID, playerID)
-	}
-
-	return ParseMoveRows(gameID, rows, err)
-
+	return store.GetMoves(gameID, MoveFilter{PlayerID: playerID})
 }
 
 func GetGameTurnMoves(gameID uint, turnCount uint) (Moves, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	var rows *sql.Rows
-
-	rows, err = db.Db.Query("SELECT turncount, playerid, targetid, type, time FROM moves WHERE gameid=? AND turncount=?", gameID, turnCount)
-	return ParseMoveRows(gameID, rows, err)
+	return store.GetMoves(gameID, MoveFilter{TurnCount: turnCount})
 }
 
 func GetGamePlayerTurnMoves(gameID, playerID, turnCount uint) (Moves, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	var rows *sql.Rows
-
-	rows, err = db.Db.Query("SELECT turncount, playerid, targetid, type, time FROM moves WHERE gameid=? AND playerID=? AND turncount=?", gameID, playerID, turnCount)
-	return ParseMoveRows(gameID, rows, err)
-}
-
-func ParseMoveRows(gameID uint, rows *sql.Rows, err error) (Moves, error) {
-	moves := make(Moves, 0)
-	var timeString string
-
-	if rows != nil {
-		defer rows.Close()
-	}
-	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		var move Move
-		move.GameID = gameID
-		if err := rows.Scan(&move.TurnCount, &move.PlayerID, &move.TargetID, &move.Type, &timeString); err != nil {
-			return nil, err
-		}
-
-		move.Time, err = time.Parse(sqlForm, timeString)
-		if err != nil {
-			return nil, err
-		}
-		moves = append(moves, &move)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	sort.Sort(moves)
-
-	return moves, nil
+	return store.GetMoves(gameID, MoveFilter{PlayerID: playerID, TurnCount: turnCount})
 }
@@ -0,0 +1,424 @@
+package game
+
+import (
+	"fmt"
+	"sort"
+)
+
+// default order night actions resolve in, lowest first
+// a role can run earlier or later by setting NightAction.Priority
+const (
+	BlockPriority       = 10
+	ProtectPriority     = 20
+	KillPriority        = 30
+	CleanPriority       = 33 // after kills so that there is a body to clean
+	FramePriority       = 36 // before investigations so that they see the frame
+	InvestigatePriority = 40
+	WatchPriority       = 50 // after everything else, with every unblocked visit recorded before it
+)
+
+var kindPriorities = map[uint]int{
+	BlockAction:       BlockPriority,
+	ProtectAction:     ProtectPriority,
+	KillAction:        KillPriority,
+	InvestigateAction: InvestigatePriority,
+	FrameAction:       FramePriority,
+	CleanAction:       CleanPriority,
+}
+
+// gets when the action resolves
+func (a NightAction) priority() int {
+	if a.Priority != 0 {
+		return a.Priority
+	}
+	return kindPriorities[a.Kind]
+}
+
+// kinds of night results
+const (
+	BlockedResult     = "Blocked"     // your action was blocked
+	SavedResult       = "Saved"       // you were attacked and saved
+	ProtectedResult   = "Protected"   // the player you protected was attacked and saved
+	KilledResult      = "Killed"      // you were killed
+	KillResult        = "Kill"        // the player you attacked died
+	KillFailedResult  = "KillFailed"  // the player you attacked survived
+	InvestigateResult = "Investigate" // what you learned about your target
+	GuardedResult     = "Guarded"     // you died in place of the player you guarded
+	CleanResult       = "Clean"       // the role of the player whose body you cleaned
+	TrackResult       = "Track"       // who your target visited
+	WatchResult       = "Watch"       // who visited your target
+)
+
+// NightResult is something a single player learns from the night
+type NightResult struct {
+	PlayerID uint
+	Kind     string
+	TargetID uint
+	Message  string
+	Data     interface{} `json:",omitempty"`
+}
+
+// PlannedNightAction is one night action about to be resolved
+// collective actions have every player that voted for the target as an actor
+type PlannedNightAction struct {
+	Role    Role
+	Actors  Players
+	Target  *Player
+	Blocked bool
+
+	performer *Player
+	settled   bool // whether the performer was fixed when the action's priority came up
+}
+
+// gets the actor that carries out the action, the first one who is not blocked
+func (a *PlannedNightAction) Performer(n *NightResolution) *Player {
+	if a.settled {
+		return a.performer
+	}
+	for _, actor := range a.Actors {
+		if !n.blocked[actor.PlayerID] {
+			return actor
+		}
+	}
+	return nil
+}
+
+// fixes who performs the action, so that blocks resolving at the same priority do not change it
+func (a *PlannedNightAction) settle(n *NightResolution) {
+	a.performer = a.Performer(n)
+	a.settled = true
+	a.Blocked = a.performer == nil
+}
+
+// NightResolution holds the state of a night while its actions resolve
+type NightResolution struct {
+	Game    *Game
+	Actions []*PlannedNightAction
+	// players who died, in the order they died
+	Deaths Players
+	// what each player learned, keyed by PlayerID
+	Results map[uint][]NightResult
+
+	blocked   map[uint]bool
+	framed    map[uint]bool
+	protected map[uint]Players // target to the players protecting them
+	guards    map[uint]Players // target to the players who would die in their place
+	visits    map[uint]uint    // performer to target
+	dead      map[uint]bool
+	reveals   map[uint]uint // player to what is revealed if they die, when not the game's DeathReveal
+}
+
+// collects the night's moves into actions sorted by when they resolve
+// collective roles have their votes counted and act on the plurality target
+// roles that join another role's vote, like the godfather, are counted with it
+// a tied vote goes to the target who was voted for first, then the lowest PlayerID
+func planNight(g *Game, moves Moves) ([]*PlannedNightAction, error) {
+	actions := make([]*PlannedNightAction, 0)
+
+	type vote struct {
+		target *Player
+		count  int
+		first  int // index of the first move for the target
+		actors Players
+	}
+	// role ID to target ID to votes
+	collective := make(map[uint]map[uint]*vote)
+
+	// earliest moves first so that ties are broken by time
+	sorted := make(Moves, len(moves))
+	copy(sorted, moves)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	for i, move := range sorted {
+		player, err := g.FindPlayerWithID(move.PlayerID)
+		if err != nil {
+			return nil, err
+		}
+		role := player.Role()
+		if role == nil || role.ID() != move.Type { // bad move by player
+			continue
+		}
+		action := role.NightAction()
+		if action.Kind == NoAction || move.TargetID == 0 {
+			continue
+		}
+		target, err := g.FindPlayerWithID(move.TargetID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !action.Collective {
+			actions = append(actions, &PlannedNightAction{Role: role, Actors: Players{player}, Target: target})
+			continue
+		}
+
+		group := action.group(role)
+		if _, ok := collective[group]; !ok {
+			collective[group] = make(map[uint]*vote)
+		}
+		v, ok := collective[group][target.PlayerID]
+		if !ok {
+			v = &vote{target: target, first: i}
+			collective[group][target.PlayerID] = v
+		}
+		v.count += 1
+		v.actors = append(v.actors, player)
+	}
+
+	for roleID, votes := range collective {
+		var best *vote
+		for _, v := range votes {
+			if best == nil || v.count > best.count ||
+				(v.count == best.count && (v.first < best.first ||
+					(v.first == best.first && v.target.PlayerID < best.target.PlayerID))) {
+				best = v
+			}
+		}
+		role, err := GetRole(roleID)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, &PlannedNightAction{Role: role, Actors: best.actors, Target: best.target})
+	}
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		a, b := actions[i], actions[j]
+		if a.Role.NightAction().priority() != b.Role.NightAction().priority() {
+			return a.Role.NightAction().priority() < b.Role.NightAction().priority()
+		}
+		if a.Role.ID() != b.Role.ID() {
+			return a.Role.ID() < b.Role.ID()
+		}
+		return a.Actors[0].PlayerID < b.Actors[0].PlayerID
+	})
+
+	return actions, nil
+}
+
+// Resolves a night's moves in priority order
+// Nothing is written, the deaths and results are returned to be applied
+func ResolveNight(g *Game, moves Moves) (*NightResolution, error) {
+	actions, err := planNight(g, moves)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &NightResolution{
+		Game:      g,
+		Actions:   actions,
+		Deaths:    make(Players, 0),
+		Results:   make(map[uint][]NightResult),
+		blocked:   make(map[uint]bool),
+		framed:    make(map[uint]bool),
+		protected: make(map[uint]Players),
+		guards:    make(map[uint]Players),
+		visits:    make(map[uint]uint),
+		dead:      make(map[uint]bool),
+		reveals:   make(map[uint]uint),
+	}
+
+	watching := false
+	for i, action := range n.Actions {
+		priority := action.Role.NightAction().priority()
+		if i == 0 || priority != n.Actions[i-1].Role.NightAction().priority() {
+			// watchers see every visit of the night, even from actions that resolve alongside or after them
+			if !watching && priority >= WatchPriority {
+				watching = true
+				n.recordVisits(n.Actions[i:])
+			}
+
+			// actions at the same priority resolve together, so a roleblocker and a consort
+			// who block each other are both blocked, and neither block stops the other
+			for _, other := range n.Actions[i:] {
+				if other.Role.NightAction().priority() != priority {
+					break
+				}
+				other.settle(n)
+			}
+		}
+
+		performer := action.Performer(n)
+		if performer == nil {
+			for _, actor := range action.Actors {
+				n.AddResult(actor, BlockedResult, action.Target, "You were blocked and could not act")
+			}
+			continue
+		}
+		n.visits[performer.PlayerID] = action.Target.PlayerID
+
+		err = action.Role.ResolveNight(n, action)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// records who the performer of each action visits, leaving out blocked actions
+func (n *NightResolution) recordVisits(actions []*PlannedNightAction) {
+	for _, action := range actions {
+		if performer := action.Performer(n); performer != nil {
+			n.visits[performer.PlayerID] = action.Target.PlayerID
+		}
+	}
+}
+
+// Adds something a player learned from the night
+func (n *NightResolution) AddResult(p *Player, kind string, target *Player, message string) {
+	n.AddResultData(p, kind, target, message, nil)
+}
+
+// Adds something a player learned from the night with extra data
+func (n *NightResolution) AddResultData(p *Player, kind string, target *Player, message string, data interface{}) {
+	var targetID uint
+	if target != nil {
+		targetID = target.PlayerID
+	}
+	n.Results[p.PlayerID] = append(n.Results[p.PlayerID], NightResult{p.PlayerID, kind, targetID, message, data})
+}
+
+// Stops every action the player takes later in the night
+func (n *NightResolution) Block(target *Player) {
+	n.blocked[target.PlayerID] = true
+}
+
+// Whether the player's actions are blocked
+func (n *NightResolution) IsBlocked(p *Player) bool {
+	return n.blocked[p.PlayerID]
+}
+
+// Makes the target look guilty to investigations later in the night
+func (n *NightResolution) Frame(target *Player) {
+	n.framed[target.PlayerID] = true
+}
+
+// Whether the player was framed tonight
+func (n *NightResolution) IsFramed(p *Player) bool {
+	return n.framed[p.PlayerID]
+}
+
+// Stops the target from dying to attacks later in the night
+func (n *NightResolution) Protect(protectors Players, target *Player) {
+	n.protected[target.PlayerID] = append(n.protected[target.PlayerID], protectors...)
+}
+
+// Gets who is protecting a player
+func (n *NightResolution) Protectors(p *Player) Players {
+	return n.protected[p.PlayerID]
+}
+
+// Has the guard die in place of the target if the target is attacked later in the night
+func (n *NightResolution) Guard(guard *Player, target *Player) {
+	n.guards[target.PlayerID] = append(n.guards[target.PlayerID], guard)
+}
+
+// gets the first guard of a player who is still alive to take an attack for them
+func (n *NightResolution) guard(p *Player) *Player {
+	for _, guard := range n.guards[p.PlayerID] {
+		if !n.dead[guard.PlayerID] {
+			return guard
+		}
+	}
+	return nil
+}
+
+// Attacks the target, who dies unless they are protected
+// a guard dies instead of a target nobody protected, and kills the attacker who carried it out
+// returns whether the target died
+func (n *NightResolution) Attack(attackers Players, target *Player) bool {
+	if n.dead[target.PlayerID] {
+		return true
+	}
+
+	protectors := n.protected[target.PlayerID]
+	if len(protectors) > 0 {
+		n.AddResult(target, SavedResult, nil, "You were attacked but someone saved you")
+		for _, protector := range protectors {
+			n.AddResult(protector, ProtectedResult, target, "Your target was attacked and you saved them")
+		}
+		for _, attacker := range attackers {
+			n.AddResult(attacker, KillFailedResult, target, "Your target survived")
+		}
+		return false
+	}
+
+	if guard := n.guard(target); guard != nil {
+		n.AddResult(target, SavedResult, nil, "You were attacked but someone saved you")
+		n.AddResult(guard, GuardedResult, target, "Your target was attacked and you died in their place, taking the attacker with you")
+		n.Kill(guard)
+		for _, attacker := range attackers {
+			n.AddResult(attacker, KillFailedResult, target, "Your target survived")
+		}
+		for _, attacker := range attackers {
+			if !n.blocked[attacker.PlayerID] {
+				n.Kill(attacker)
+				break
+			}
+		}
+		return false
+	}
+
+	n.Kill(target)
+	for _, attacker := range attackers {
+		n.AddResult(attacker, KillResult, target, "Your target was killed")
+	}
+	return true
+}
+
+// Kills a player no matter who is protecting them
+// players who were already dead before the night stay as they died, so a lynched jester keeps their win
+func (n *NightResolution) Kill(target *Player) {
+	if n.dead[target.PlayerID] || !target.Alive {
+		return
+	}
+	n.dead[target.PlayerID] = true
+	n.Deaths = append(n.Deaths, target)
+	n.AddResult(target, KilledResult, nil, "You were killed")
+}
+
+// Whether a player has died so far tonight
+func (n *NightResolution) IsDead(p *Player) bool {
+	return n.dead[p.PlayerID]
+}
+
+// Gets who a player visited tonight, 0 if they stayed home
+func (n *NightResolution) Visited(p *Player) uint {
+	return n.visits[p.PlayerID]
+}
+
+// Gets everyone who visited a player tonight sorted by PlayerID
+func (n *NightResolution) Visitors(p *Player) []uint {
+	visitors := make([]uint, 0)
+	for visitor, target := range n.visits {
+		if target == p.PlayerID {
+			visitors = append(visitors, visitor)
+		}
+	}
+	sort.Slice(visitors, func(i, j int) bool { return visitors[i] < visitors[j] })
+	return visitors
+}
+
+// default resolution for each kind of action
+// roles with special behaviour override ResolveNight and can call this for the rest
+func resolveDefault(n *NightResolution, a *PlannedNightAction) error {
+	switch a.Role.NightAction().Kind {
+	case BlockAction:
+		n.Block(a.Target)
+	case ProtectAction:
+		n.Protect(a.Actors, a.Target)
+	case KillAction:
+		n.Attack(a.Actors, a.Target)
+	case FrameAction:
+		n.Frame(a.Target)
+	case InvestigateAction:
+		result, err := a.Role.Investigate(n, a.Target)
+		if err != nil {
+			return err
+		}
+		for _, actor := range a.Actors {
+			n.AddResultData(actor, InvestigateResult, a.Target, fmt.Sprintf("You investigated %s", a.Target.Name), result)
+		}
+	}
+	return nil
+}
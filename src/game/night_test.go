@@ -0,0 +1,392 @@
+package game
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// a night move by the player labelled actor on the player labelled target
+// rejected moves are expected to be refused when they are made
+type nightMove struct {
+	actor    string
+	target   string
+	rejected bool
+}
+
+// starts a game in a fresh memory store and plays it to the first night
+// players are labelled by their role, with a number after the first of each, like Villager and Villager2
+func startNight(t *testing.T, options GameOptions) (*Game, map[string]uint) {
+	SetStore(NewMemoryStore())
+	g, err := MakeGame(options)
+	if err != nil {
+		t.Fatalf("MakeGame failed: %v", err)
+	}
+	for i := uint(0); i < options.PlayerCount; i++ {
+		err = g.RegisterPlayer(fmt.Sprintf("Player %d", i+1))
+		if err != nil {
+			t.Fatalf("RegisterPlayer failed: %v", err)
+		}
+	}
+	if g.Stage != 1 {
+		t.Fatalf("game is at stage %d after everyone registered, want the night", g.Stage)
+	}
+
+	labels := make(map[string]uint)
+	seen := make(map[string]int)
+	for _, p := range g.Players {
+		name := p.Role().Name()
+		seen[name] += 1
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s%d", name, seen[name])
+		}
+		labels[name] = p.PlayerID
+	}
+	return g, labels
+}
+
+// makes the moves and ends the night
+func playNight(t *testing.T, g *Game, labels map[string]uint, moves []nightMove) {
+	for _, m := range moves {
+		actor, err := g.FindPlayerWithID(labels[m.actor])
+		if err != nil {
+			t.Fatalf("no player %s", m.actor)
+		}
+		_, err = g.MakeGameMove(actor.PlayerID, labels[m.target], actor.role)
+		if m.rejected && err == nil {
+			t.Errorf("%s was allowed to target %s", m.actor, m.target)
+		} else if !m.rejected && err != nil {
+			t.Fatalf("%s could not target %s: %v", m.actor, m.target, err)
+		}
+	}
+	if g.Stage == 1 {
+		err := g.ProgressStage()
+		if err != nil {
+			t.Fatalf("ending the night failed: %v", err)
+		}
+	}
+}
+
+// ends the day without lynching anyone
+func skipDay(t *testing.T, g *Game) {
+	err := g.ProgressStage()
+	if err != nil {
+		t.Fatalf("ending the day failed: %v", err)
+	}
+	if g.Stage != 1 {
+		t.Fatalf("game is at stage %d after the day, want the night", g.Stage)
+	}
+}
+
+// writes a night result with the players in it labelled, like "Track Villager"
+func describeResult(r NightResult, names map[uint]string) string {
+	parts := []string{r.Kind}
+	switch data := r.Data.(type) {
+	case uint:
+		if data == 0 {
+			parts = append(parts, "nobody")
+		} else {
+			parts = append(parts, names[data])
+		}
+	case []uint:
+		visitors := make([]string, 0, len(data))
+		for _, id := range data {
+			visitors = append(visitors, names[id])
+		}
+		sort.Strings(visitors)
+		if len(visitors) == 0 {
+			visitors = append(visitors, "nobody")
+		}
+		parts = append(parts, strings.Join(visitors, ","))
+	case bool:
+		if data {
+			parts = append(parts, "guilty")
+		} else {
+			parts = append(parts, "innocent")
+		}
+	case string:
+		parts = append(parts, data)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestNightScenarios(t *testing.T) {
+	tests := []struct {
+		name    string
+		options GameOptions
+		nights  [][]nightMove // a day where nobody is lynched comes between each night
+		dead    []string      // everyone who has died by the end
+		results map[string][]string
+	}{
+		{
+			name:    "vigilante runs out of shots",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, VigilanteCount: 1},
+			nights: [][]nightMove{
+				{{"Vigilante", "Villager", false}},
+				{{"Vigilante", "Villager2", false}},
+				{{"Vigilante", "Villager3", true}},
+			},
+			dead:    []string{"Villager", "Villager2"},
+			results: map[string][]string{},
+		},
+		{
+			name:    "blocked vigilante still spends the shot",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, VigilanteCount: 1, RoleblockerCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Vigilante", false}, {"Vigilante", "Villager", false}},
+				{{"Vigilante", "Villager2", false}},
+				{{"Vigilante", "Villager3", true}},
+			},
+			dead:    []string{"Villager2"},
+			results: map[string][]string{},
+		},
+		{
+			name:    "bodyguard dies in place of the target and kills the attacker",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 2, BodyguardCount: 1},
+			nights: [][]nightMove{
+				{{"Mafia", "Villager", false}, {"Mafia2", "Villager", false}, {"Bodyguard", "Villager", false}},
+			},
+			dead: []string{"Bodyguard", "Mafia"},
+			results: map[string][]string{
+				"Villager":  {"Saved"},
+				"Bodyguard": {"Guarded", "Killed"},
+				"Mafia":     {"KillFailed", "Killed"},
+				"Mafia2":    {"KillFailed"},
+			},
+		},
+		{
+			name:    "roleblocker stops the mafia kill",
+			options: GameOptions{PlayerCount: 5, MafiaCount: 1, RoleblockerCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Mafia", false}, {"Mafia", "Villager", false}},
+			},
+			dead:    []string{},
+			results: map[string][]string{"Mafia": {"Blocked"}},
+		},
+		{
+			name:    "roleblocker stops the doctor's save",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, DoctorCount: 1, RoleblockerCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Doctor", false}, {"Doctor", "Villager", false}, {"Mafia", "Villager", false}},
+			},
+			dead: []string{"Villager"},
+			results: map[string][]string{
+				"Doctor":   {"Blocked"},
+				"Mafia":    {"Kill"},
+				"Villager": {"Killed"},
+			},
+		},
+		{
+			name:    "tracker and lookout see several visitors",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, DoctorCount: 1, TrackerCount: 1, LookoutCount: 1},
+			nights: [][]nightMove{
+				{{"Mafia", "Villager", false}, {"Doctor", "Villager", false}, {"Tracker", "Doctor", false}, {"Lookout", "Villager", false}},
+			},
+			dead: []string{},
+			results: map[string][]string{
+				"Mafia":    {"KillFailed"},
+				"Doctor":   {"Protected"},
+				"Villager": {"Saved"},
+				"Tracker":  {"Track Villager"},
+				"Lookout":  {"Watch Doctor,Mafia"},
+			},
+		},
+		{
+			name:    "tracker and lookout do not see a blocked visitor",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, RoleblockerCount: 1, TrackerCount: 1, LookoutCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Mafia", false}, {"Mafia", "Villager", false}, {"Tracker", "Mafia", false}, {"Lookout", "Villager", false}},
+			},
+			dead: []string{},
+			results: map[string][]string{
+				"Mafia":   {"Blocked"},
+				"Tracker": {"Track nobody"},
+				"Lookout": {"Watch nobody"},
+			},
+		},
+		{
+			name:    "lookout sees the roleblocker and tracker at a blocked player's house",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, RoleblockerCount: 1, TrackerCount: 1, LookoutCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Mafia", false}, {"Mafia", "Villager", false}, {"Tracker", "Mafia", false}, {"Lookout", "Mafia", false}},
+			},
+			dead: []string{},
+			results: map[string][]string{
+				"Mafia":   {"Blocked"},
+				"Tracker": {"Track nobody"},
+				"Lookout": {"Watch Roleblocker,Tracker"},
+			},
+		},
+		{
+			name:    "tracker follows a lookout",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, TrackerCount: 1, LookoutCount: 1},
+			nights: [][]nightMove{
+				{{"Tracker", "Lookout", false}, {"Lookout", "Villager", false}},
+			},
+			dead: []string{},
+			results: map[string][]string{
+				"Tracker": {"Track Villager"},
+				"Lookout": {"Watch nobody"},
+			},
+		},
+		{
+			name:    "two lookouts watch the same house",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, LookoutCount: 2},
+			nights: [][]nightMove{
+				{{"Lookout", "Villager", false}, {"Lookout2", "Villager", false}},
+			},
+			dead: []string{},
+			results: map[string][]string{
+				"Lookout":  {"Watch Lookout2"},
+				"Lookout2": {"Watch Lookout"},
+			},
+		},
+		{
+			name:    "two lookouts watch each other",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, LookoutCount: 2, TrackerCount: 1},
+			nights: [][]nightMove{
+				{{"Lookout", "Lookout2", false}, {"Lookout2", "Lookout", false}, {"Tracker", "Lookout2", false}},
+			},
+			dead: []string{},
+			results: map[string][]string{
+				"Lookout":  {"Watch Tracker"},
+				"Lookout2": {"Watch nobody"},
+				"Tracker":  {"Track Lookout"},
+			},
+		},
+		{
+			name:    "blocked sherriff learns nothing",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, SherriffCount: 1, RoleblockerCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Sherriff", false}, {"Sherriff", "Mafia", false}},
+			},
+			dead:    []string{},
+			results: map[string][]string{"Sherriff": {"Blocked"}},
+		},
+		{
+			name:    "framed villager looks guilty",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, SherriffCount: 1, FramerCount: 1},
+			nights: [][]nightMove{
+				{{"Sherriff", "Villager", false}, {"Framer", "Villager", false}},
+			},
+			dead:    []string{},
+			results: map[string][]string{"Sherriff": {"Investigate guilty"}},
+		},
+		{
+			name:    "blocked framer frames nobody",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, SherriffCount: 1, FramerCount: 1, RoleblockerCount: 1},
+			nights: [][]nightMove{
+				{{"Framer", "Villager", false}, {"Roleblocker", "Framer", false}, {"Sherriff", "Villager", false}},
+			},
+			dead: []string{},
+			results: map[string][]string{
+				"Framer":   {"Blocked"},
+				"Sherriff": {"Investigate innocent"},
+			},
+		},
+		{
+			name:    "godfather looks innocent",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, GodfatherCount: 1, SherriffCount: 1},
+			nights: [][]nightMove{
+				{{"Sherriff", "Godfather", false}},
+			},
+			dead:    []string{},
+			results: map[string][]string{"Sherriff": {"Investigate innocent"}},
+		},
+		{
+			name:    "consort stops the doctor's save",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, DoctorCount: 1, ConsortCount: 1},
+			nights: [][]nightMove{
+				{{"Consort", "Doctor", false}, {"Doctor", "Villager", false}, {"Mafia", "Villager", false}},
+			},
+			dead: []string{"Villager"},
+			results: map[string][]string{
+				"Doctor":   {"Blocked"},
+				"Mafia":    {"Kill"},
+				"Villager": {"Killed"},
+			},
+		},
+		{
+			name:    "consort stops the sherriff",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, SherriffCount: 1, ConsortCount: 1},
+			nights: [][]nightMove{
+				{{"Consort", "Sherriff", false}, {"Sherriff", "Mafia", false}},
+			},
+			dead:    []string{},
+			results: map[string][]string{"Sherriff": {"Blocked"}},
+		},
+		{
+			name:    "roleblocker and consort block each other",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, RoleblockerCount: 1, ConsortCount: 1, LookoutCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Consort", false}, {"Consort", "Roleblocker", false}, {"Lookout", "Consort", false}},
+			},
+			dead:    []string{},
+			results: map[string][]string{"Lookout": {"Watch Roleblocker"}},
+		},
+		{
+			name:    "consort blocked by the roleblocker still blocks",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, DoctorCount: 1, RoleblockerCount: 1, ConsortCount: 1},
+			nights: [][]nightMove{
+				{{"Roleblocker", "Consort", false}, {"Consort", "Doctor", false}, {"Doctor", "Villager", false}, {"Mafia", "Villager", false}},
+			},
+			dead: []string{"Villager"},
+			results: map[string][]string{
+				"Doctor":   {"Blocked"},
+				"Mafia":    {"Kill"},
+				"Villager": {"Killed"},
+			},
+		},
+		{
+			name:    "roleblocker blocked by the consort still blocks",
+			options: GameOptions{PlayerCount: 7, MafiaCount: 1, DoctorCount: 1, RoleblockerCount: 1, ConsortCount: 1},
+			nights: [][]nightMove{
+				{{"Consort", "Roleblocker", false}, {"Roleblocker", "Doctor", false}, {"Doctor", "Villager", false}, {"Mafia", "Villager", false}},
+			},
+			dead: []string{"Villager"},
+			results: map[string][]string{
+				"Doctor":   {"Blocked"},
+				"Mafia":    {"Kill"},
+				"Villager": {"Killed"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, labels := startNight(t, test.options)
+			names := make(map[uint]string)
+			for name, id := range labels {
+				names[id] = name
+			}
+
+			for i, moves := range test.nights {
+				if i > 0 {
+					skipDay(t, g)
+				}
+				playNight(t, g, labels, moves)
+			}
+
+			dead := make([]string, 0)
+			results := make(map[string][]string)
+			for _, p := range g.Players {
+				if !p.Alive {
+					dead = append(dead, names[p.PlayerID])
+				}
+				for _, r := range g.NightResults(p.PlayerID) {
+					results[names[p.PlayerID]] = append(results[names[p.PlayerID]], describeResult(r, names))
+				}
+			}
+			sort.Strings(dead)
+
+			if !reflect.DeepEqual(dead, test.dead) {
+				t.Errorf("got dead %v, want %v", dead, test.dead)
+			}
+			if !reflect.DeepEqual(results, test.results) {
+				t.Errorf("got results %v, want %v", results, test.results)
+			}
+		})
+	}
+}
@@ -1,9 +1,10 @@
 package game
 
 import (
-	"database/sql"
-	"db"
-	"sort"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 )
 
 type Player struct {
@@ -12,15 +13,26 @@ type Player struct {
 	Name     string
 	role     uint // private to not show in info
 	Alive    bool
+	secret   string // token the player proves who they are with
+	Ready    bool   // ready for the lobby to start
+	// the will is private to not show in info until the player dies
+	will      string
+	LastWords string // said after being lynched
+	reveal    uint   // what was revealed when the player died
+	cause     string // how the player died
 }
 
-type PlayerIDRole struct {
+// what a player gets back when they register
+type PlayerSession struct {
 	PlayerID uint
-	Role     uint
+	Secret   string
 }
+
+var ErrBadSecret = errors.New("Secret does not match player")
+
 type Players []*Player
 
-//sorts by most recent first
+// sorts by most recent first
 func (a Players) Len() int           { return len(a) }
 func (a Players) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a Players) Less(i, j int) bool { return a[i].PlayerID < a[j].PlayerID }
@@ -28,14 +40,14 @@ func (a Players) Less(i, j int) bool { return a[i].PlayerID < a[j].PlayerID }
 // Creates a new player and uploads it to the database
 // default player has no name and no role
 func MakePlayer(gameID uint) (*Player, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
+	return makePlayer(store, gameID)
+}
 
+func makePlayer(s Store, gameID uint) (*Player, error) {
+	var err error
 	var p Player
 	p.GameID = gameID
-	p.PlayerID, err = getUniquePlayerID()
+	p.PlayerID, err = getUniquePlayerID(s)
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +55,7 @@ func MakePlayer(gameID uint) (*Player, error) {
 	p.role = 0
 	p.Alive = true
 
-	_, err = p.Upload()
+	err = s.InsertPlayer(&p)
 
 	if err != nil {
 		return nil, err
@@ -78,70 +90,69 @@ func MakePlayer(gameID uint) (*Player, error) {
 
 // }
 
-// updates database version of the game
-func (p *Player) Upload() (sql.Result, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
-	}
+// uploads a new player to the database
+func (p *Player) Upload() error {
+	return store.InsertPlayer(p)
+}
 
-	addGame, err := db.Db.Prepare("INSERT INTO players (gameid, playerid, name, role, alive) VALUES (?, ?, ?, ?, ?)")
-	if err != nil {
-		return nil, err
-	}
+// updates database version of the player
+func (p *Player) Update() error {
+	return store.UpdatePlayer(p)
+}
 
-	return addGame.Exec(p.GameID, p.PlayerID, p.Name, p.role, p.Alive)
+// gets all players in a specific game
+// sorted by playerID
+func GetGamePlayers(game uint) (Players, error) {
+	return store.GetGamePlayers(game)
 }
 
-// updates database version of the game
-func (p *Player) Update() (sql.Result, error) {
-	err := db.Db.Ping()
-	if err != nil {
-		return nil, err
+// Gets the player's role from the registry
+// nil if the player has not been dealt a role
+func (p *Player) Role() Role {
+	if p.role == 0 {
+		return nil
 	}
-
-	updateGame, err := db.Db.Prepare("UPDATE players SET name=?, role=?, alive=? WHERE gameid=? AND playerid=?")
+	role, err := GetRole(p.role)
 	if err != nil {
-		return nil, err
+		return nil
 	}
-
-	return updateGame.Exec(p.Name, p.role, p.Alive, p.GameID, p.PlayerID)
+	return role
 }
 
-// gets all players in a specific game
-// sorted by playerID
-func GetGamePlayers(game uint) (Players, error) {
-	err := db.Db.Ping()
+// makes a new random secret
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	players := make(Players, 0)
-
-	rows, err := db.Db.Query("SELECT playerid, name, role, alive FROM players WHERE gameid=?", game)
-	if rows != nil {
-		defer rows.Close()
-	}
+// makes a new random secret for the player
+func (p *Player) generateSecret() error {
+	secret, err := generateSecret()
 	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		var player Player
-		player.GameID = game
-		if err := rows.Scan(&player.PlayerID, &player.Name, &player.role, &player.Alive); err != nil {
-			return nil, err
-		}
-		players = append(players, &player)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		return err
 	}
+	p.secret = secret
+	return nil
+}
 
-	sort.Sort(players)
+// Checks a secret against the player's
+// players that never registered have no secret and never match
+func (p *Player) CheckSecret(secret string) bool {
+	if p.secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(p.secret), []byte(secret)) == 1
+}
 
-	return players, nil
+// Gets the secret, only for use in checking signed requests
+func (p *Player) Secret() string {
+	return p.secret
 }
 
-func (p *Player) PlayerIDRole() PlayerIDRole {
-	return PlayerIDRole{p.PlayerID, p.role}
+func (p *Player) Session() PlayerSession {
+	return PlayerSession{p.PlayerID, p.secret}
 }
@@ -0,0 +1,308 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Replay is a record of a finished game turn by turn
+type Replay struct {
+	GameID  uint
+	Over    bool        // false when the moderator looks at a game still being played
+	Winner  string      // name of the team that won, empty if the moderator ended it or it was a draw
+	Result  *GameResult `json:",omitempty"`
+	Players []PlayerView
+	Turns   []ReplayTurn
+}
+
+// ReplayTurn is what happened in one night or day
+type ReplayTurn struct {
+	TurnCount uint
+	Stage     string // "Night", "Day", "Runoff", "Defense", "Judgment" or "LastWords"
+	Moves     []ReplayMove
+	Deaths    []ReplayDeath
+}
+
+// ReplayMove is a night action, day vote or judgment vote as it stood when the turn ended
+type ReplayMove struct {
+	PlayerID uint
+	Player   string
+	Action   string
+	TargetID uint
+	Target   string `json:",omitempty"`
+}
+
+// ReplayDeath is a player who died during a turn
+type ReplayDeath struct {
+	PlayerID uint
+	Player   string
+	Cause    string
+}
+
+// Gets the team that won the game, nil if no team has won
+func (g *Game) Winner() *Team {
+	for _, team := range Teams() {
+		if team.VictoryStage != 0 && g.Stage == team.VictoryStage {
+			return team
+		}
+	}
+	return nil
+}
+
+// gets the name of a player for the replay
+func (g *Game) playerName(playerID uint) string {
+	if playerID == 0 {
+		return ""
+	}
+	p, err := g.FindPlayerWithID(playerID)
+	if err != nil {
+		return fmt.Sprintf("Player %d", playerID)
+	}
+	return p.Name
+}
+
+// what roles without a night action, like villagers, do at night
+const sleepAction = "sleeps"
+
+// what judgment votes do, written without their target
+var judgmentActions = map[uint]string{
+	GuiltyVote:   "votes guilty",
+	InnocentVote: "votes innocent",
+	AbstainVote:  "abstains",
+}
+
+// describes what a move does
+func moveAction(m *Move) string {
+	if m.Type == 0 {
+		return "votes for"
+	}
+	if action, ok := judgmentActions[m.Type]; ok {
+		return action
+	}
+	role, err := GetRole(m.Type)
+	if err != nil {
+		return "targets"
+	}
+	switch role.NightAction().Kind {
+	case KillAction:
+		return "kills"
+	case ProtectAction:
+		return "protects"
+	case InvestigateAction:
+		return "investigates"
+	case BlockAction:
+		return "blocks"
+	case FrameAction:
+		return "frames"
+	case CleanAction:
+		return "cleans"
+	}
+	return sleepAction
+}
+
+// Builds the replay of the game
+// the stages and deaths of each turn come from the game's history
+// games without one fall back to nights on odd turns and no deaths
+func (g *Game) Replay() (*Replay, error) {
+	events, err := g.History()
+	if err != nil {
+		return nil, err
+	}
+
+	replay := Replay{
+		GameID:  g.GameID,
+		Over:    g.IsOver(),
+		Result:  g.Result,
+		Players: g.View(Viewer{Moderator: true}).Players,
+		Turns:   make([]ReplayTurn, 0, g.TurnCount),
+	}
+	if winner := g.Winner(); winner != nil {
+		replay.Winner = winner.Name
+	}
+
+	stages := make(map[uint]StageData)
+	deaths := make(map[uint][]ReplayDeath)
+	var turn uint
+	for _, e := range events {
+		switch e.Type {
+		case EventStage:
+			var data StageData
+			if err = json.Unmarshal(e.Data, &data); err != nil {
+				return nil, err
+			}
+			turn = data.TurnCount
+			stages[turn] = data
+		case EventDied:
+			var data PlayerData
+			if err = json.Unmarshal(e.Data, &data); err != nil {
+				return nil, err
+			}
+			deaths[turn] = append(deaths[turn], ReplayDeath{data.PlayerID, g.playerName(data.PlayerID), data.Cause})
+		}
+	}
+
+	for t := uint(1); t <= g.TurnCount; t++ {
+		stage, ok := stages[t]
+		if !ok {
+			stage.Stage = 2 - int(t%2)
+		}
+
+		rt := ReplayTurn{TurnCount: t, Stage: "Day", Moves: make([]ReplayMove, 0), Deaths: deaths[t]}
+		if stage.Stage == 1 {
+			rt.Stage = "Night"
+		} else if stage.Stage == DefenseStage {
+			rt.Stage = "Defense"
+		} else if stage.Stage == JudgmentStage {
+			rt.Stage = "Judgment"
+		} else if stage.Stage == LastWordsStage {
+			rt.Stage = "LastWords"
+		} else if len(stage.Runoff) != 0 {
+			rt.Stage = "Runoff"
+		}
+		if rt.Deaths == nil {
+			rt.Deaths = make([]ReplayDeath, 0)
+		}
+
+		// Moves are sorted by turn then player
+		for _, m := range g.Moves {
+			if m.TurnCount != t {
+				continue
+			}
+			rt.Moves = append(rt.Moves, ReplayMove{
+				PlayerID: m.PlayerID,
+				Player:   g.playerName(m.PlayerID),
+				Action:   moveAction(m),
+				TargetID: m.TargetID,
+				Target:   g.playerName(m.TargetID),
+			})
+		}
+
+		// turns that never started, like the one after the winning turn, are left out
+		if len(rt.Moves) != 0 || len(rt.Deaths) != 0 || ok {
+			replay.Turns = append(replay.Turns, rt)
+		}
+	}
+
+	return &replay, nil
+}
+
+// writes a move as a sentence
+func (m ReplayMove) String() string {
+	if m.Action == sleepAction {
+		return fmt.Sprintf("%s sleeps", m.Player)
+	}
+	for _, action := range judgmentActions {
+		if m.Action == action {
+			return fmt.Sprintf("%s %s", m.Player, action)
+		}
+	}
+	if m.TargetID == 0 {
+		return fmt.Sprintf("%s does nothing", m.Player)
+	}
+	return fmt.Sprintf("%s %s %s", m.Player, m.Action, m.Target)
+}
+
+// writes a death as a sentence
+func (d ReplayDeath) String() string {
+	switch d.Cause {
+	case DeathNight:
+		return fmt.Sprintf("%s was killed in the night", d.Player)
+	case DeathLynch:
+		return fmt.Sprintf("%s was lynched", d.Player)
+	case DeathModerator:
+		return fmt.Sprintf("%s was killed by the moderator", d.Player)
+	}
+	return fmt.Sprintf("%s died", d.Player)
+}
+
+// writes who won as a sentence
+func (r *Replay) result() string {
+	if !r.Over {
+		return "The game is still being played"
+	}
+	if r.Result != nil && r.Result.Draw {
+		if len(r.Result.EndedBy) > 0 {
+			return fmt.Sprintf("The game ended in a draw between %s", strings.Join(r.Result.EndedBy, " and "))
+		}
+		return "The game ended in a draw"
+	}
+	if r.Winner == "" {
+		return "The moderator ended the game"
+	}
+	return fmt.Sprintf("%s wins", r.Winner)
+}
+
+// names every player who won, empty if nobody did
+func (r *Replay) winners() string {
+	if r.Result == nil {
+		return ""
+	}
+	names := make([]string, 0, len(r.Result.PlayerIDs))
+	for _, p := range r.Players {
+		if r.Result.Won(p.PlayerID) {
+			names = append(names, p.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Writes the replay as plain text
+func (r *Replay) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Game %d\n%s\n", r.GameID, r.result())
+	if winners := r.winners(); winners != "" {
+		fmt.Fprintf(&b, "Winners: %s\n", winners)
+	}
+	b.WriteString("\nPlayers\n")
+	for _, p := range r.Players {
+		fmt.Fprintf(&b, "  %s: %s (%s)", p.Name, p.Role, p.Team)
+		if !p.Alive {
+			b.WriteString(", dead")
+		}
+		b.WriteString("\n")
+	}
+
+	for _, t := range r.Turns {
+		fmt.Fprintf(&b, "\nTurn %d (%s)\n", t.TurnCount, t.Stage)
+		for _, m := range t.Moves {
+			fmt.Fprintf(&b, "  %s\n", m)
+		}
+		for _, d := range t.Deaths {
+			fmt.Fprintf(&b, "  %s\n", d)
+		}
+	}
+	return b.String()
+}
+
+// Writes the replay as markdown
+func (r *Replay) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Game %d\n\n**%s**\n\n", r.GameID, r.result())
+	if winners := r.winners(); winners != "" {
+		fmt.Fprintf(&b, "Winners: %s\n\n", strings.Replace(winners, "|", "\\|", -1))
+	}
+	b.WriteString("## Players\n\n| Player | Role | Team | Alive |\n| --- | --- | --- | --- |\n")
+	for _, p := range r.Players {
+		alive := "no"
+		if p.Alive {
+			alive = "yes"
+		}
+		// a pipe in a name would end its cell
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", strings.Replace(p.Name, "|", "\\|", -1), p.Role, p.Team, alive)
+	}
+
+	for _, t := range r.Turns {
+		fmt.Fprintf(&b, "\n## Turn %d (%s)\n\n", t.TurnCount, t.Stage)
+		if len(t.Moves) == 0 && len(t.Deaths) == 0 {
+			b.WriteString("Nothing happened.\n")
+		}
+		for _, m := range t.Moves {
+			fmt.Fprintf(&b, "- %s\n", m)
+		}
+		for _, d := range t.Deaths {
+			fmt.Fprintf(&b, "- **%s**\n", d)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package game
+
+import "testing"
+
+func TestReplayLastWords(t *testing.T) {
+	g, labels := startNight(t, GameOptions{PlayerCount: 5, MafiaCount: 1, LastWordsIntervals: 2})
+	playNight(t, g, labels, nil)
+
+	for _, p := range g.Players {
+		_, err := g.MakeGameMove(p.PlayerID, labels["Villager"], 0)
+		if err != nil {
+			t.Fatalf("voting failed: %v", err)
+		}
+	}
+	if g.Stage != LastWordsStage {
+		t.Fatalf("game is at stage %d after the lynch, want the last words", g.Stage)
+	}
+	err := g.SetLastWords(labels["Villager"], "goodbye")
+	if err != nil {
+		t.Fatalf("SetLastWords failed: %v", err)
+	}
+
+	replay, err := g.Replay()
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	stages := make([]string, 0)
+	for _, turn := range replay.Turns {
+		stages = append(stages, turn.Stage)
+	}
+	want := []string{"Night", "Day", "LastWords", "Night"}
+	if len(stages) != len(want) {
+		t.Fatalf("got turns %v, want %v", stages, want)
+	}
+	for i := range want {
+		if stages[i] != want[i] {
+			t.Fatalf("got turns %v, want %v", stages, want)
+		}
+	}
+
+	// the lynch is in the day it happened, not in the last words after it
+	deaths := replay.Turns[1].Deaths
+	if len(deaths) != 1 || deaths[0].PlayerID != labels["Villager"] {
+		t.Errorf("got deaths %+v in the day, want the lynched villager", deaths)
+	}
+	if len(replay.Turns[2].Deaths) != 0 {
+		t.Errorf("got deaths %+v in the last words, want none", replay.Turns[2].Deaths)
+	}
+}
@@ -0,0 +1,54 @@
+package game
+
+// what everyone is told about a player when they die, picked with GameOptions.DeathReveal
+const (
+	NoReveal   uint = iota // nothing, the default
+	TeamReveal             // only the team they played for
+	RoleReveal             // their role and team
+)
+
+var DeathRevealNames = []string{"None", "Team", "Role"}
+
+// reveals nothing about a body a janitor cleaned, not even the will
+// only set by night actions, so it is not a DeathReveal option
+const CleanedReveal uint = 3
+
+// gets the role and team shown for a dead player, empty for what stays hidden
+func (p *Player) revealed() (string, string) {
+	role := p.Role()
+	if p.Alive || role == nil {
+		return "", ""
+	}
+	switch p.reveal {
+	case RoleReveal:
+		return role.Name(), role.Team().Name
+	case TeamReveal:
+		return "", role.Team().Name
+	}
+	return "", ""
+}
+
+// kills a player, revealing as much about them as reveal says
+func (g *Game) killPlayer(p *Player, cause string, reveal uint) error {
+	p.Alive = false
+	p.cause = cause
+	p.reveal = reveal
+	err := g.db().UpdatePlayer(p)
+	if err != nil {
+		return err
+	}
+	return g.record(EventDied, PlayerData{PlayerID: p.PlayerID, Cause: cause, Reveal: reveal})
+}
+
+// Changes what is revealed about a player if they die tonight, like a janitor cleaning the body
+func (n *NightResolution) SetReveal(p *Player, reveal uint) {
+	n.reveals[p.PlayerID] = reveal
+}
+
+// Gets what is revealed about a player who dies tonight
+func (n *NightResolution) Reveal(p *Player) uint {
+	if reveal, ok := n.reveals[p.PlayerID]; ok {
+		return reveal
+	}
+	return n.Game.Options.DeathReveal
+}
@@ -0,0 +1,198 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Team is a side that roles play for
+type Team struct {
+	Name string
+	// stage the game moves to when the team wins, 0 for teams that cannot win on their own
+	VictoryStage int
+	// how players on the team win, unless their role has its own condition
+	Win WinCondition
+}
+
+var (
+	TownTeam         = &Team{Name: "Town", VictoryStage: 11, Win: teamWin{}}
+	MafiaTeam        = &Team{Name: "Mafia", VictoryStage: 12, Win: teamWin{parity: true}}
+	SerialKillerTeam = &Team{Name: "SerialKiller", VictoryStage: 15, Win: lastAliveWin{}}
+	// neutral roles each have their own win condition and win alongside whoever ends the game
+	NeutralTeam = &Team{Name: "Neutral"}
+)
+
+// kinds of night actions
+const (
+	NoAction          = iota // wakes up but does nothing, like a villager
+	KillAction               // tries to kill the target
+	ProtectAction            // stops the target from being killed
+	InvestigateAction        // learns something about the target
+	BlockAction              // stops the target's action
+	FrameAction              // makes the target look guilty to investigations
+	CleanAction              // hides the role of the target if they die
+)
+
+// NightAction describes what a role does at night
+type NightAction struct {
+	Kind uint
+	// whether everyone with the role votes on one target together
+	Collective bool
+	// whether the move can be changed once it is made
+	Final bool
+	// when the action resolves at night, 0 uses the default for Kind
+	Priority int
+	// ID of the role whose collective vote the action counts towards, 0 for the role's own
+	Joins uint
+}
+
+// gets the ID of the role whose vote the action counts towards
+func (a NightAction) group(r Role) uint {
+	if a.Joins != 0 {
+		return a.Joins
+	}
+	return r.ID()
+}
+
+// Role is a role that a player can be dealt
+// roles are stored by ID, which is also the move type of their night move
+type Role interface {
+	ID() uint
+	Name() string
+	Team() *Team
+
+	// how many players get the role in a game with these options
+	Count(o *GameOptions) uint
+
+	// what the role does at night
+	NightAction() NightAction
+	// checks the target of a night move before the move is made
+	CheckMove(g *Game, p *Player, target *Player) error
+	// resolves the role's planned night action
+	ResolveNight(n *NightResolution, a *PlannedNightAction) error
+	// what an investigation of target finds out, given in the night's results
+	Investigate(n *NightResolution, target *Player) (interface{}, error)
+
+	// whether a player with this role knows the role of a player with other
+	KnowsRole(other Role) bool
+	// whether an investigation finds the role guilty
+	Suspicious() bool
+
+	// how a player with the role wins
+	WinCondition() WinCondition
+}
+
+var roleRegistryMutex sync.RWMutex
+var roleRegistry = make(map[uint]Role)
+
+// Adds a role to the registry so that it can be dealt
+// panics if a role already has the same ID, like database/sql.Register
+func RegisterRole(r Role) {
+	roleRegistryMutex.Lock()
+	defer roleRegistryMutex.Unlock()
+
+	if r.ID() == 0 {
+		panic("game: role ID 0 is reserved for players without a role")
+	}
+	if isJudgmentVote(r.ID()) {
+		panic(fmt.Sprintf("game: role ID %d is the move type of a judgment vote", r.ID()))
+	}
+	if _, ok := roleRegistry[r.ID()]; ok {
+		panic(fmt.Sprintf("game: RegisterRole called twice for role %d", r.ID()))
+	}
+	roleRegistry[r.ID()] = r
+}
+
+// Gets a role from the registry
+func GetRole(id uint) (Role, error) {
+	roleRegistryMutex.RLock()
+	defer roleRegistryMutex.RUnlock()
+
+	r, ok := roleRegistry[id]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Role %d not found", id))
+	}
+	return r, nil
+}
+
+// Gets a role from the registry by name
+func GetRoleByName(name string) (Role, error) {
+	for _, r := range Roles() {
+		if r.Name() == name {
+			return r, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Role %s not found", name))
+}
+
+// Gets a team that a registered role plays for by name
+func GetTeam(name string) (*Team, error) {
+	for _, r := range Roles() {
+		if r.Team().Name == name {
+			return r.Team(), nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Team %s not found", name))
+}
+
+// Gets every registered role sorted by ID
+func Roles() []Role {
+	roleRegistryMutex.RLock()
+	defer roleRegistryMutex.RUnlock()
+
+	roles := make([]Role, 0, len(roleRegistry))
+	for _, r := range roleRegistry {
+		roles = append(roles, r)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID() < roles[j].ID() })
+	return roles
+}
+
+// baseRole has the defaults for a role, real roles embed it
+type baseRole struct {
+	id   uint
+	name string
+	team *Team
+}
+
+func (r baseRole) ID() uint {
+	return r.id
+}
+
+func (r baseRole) Name() string {
+	return r.name
+}
+
+func (r baseRole) Team() *Team {
+	return r.team
+}
+
+func (r baseRole) NightAction() NightAction {
+	return NightAction{Kind: NoAction}
+}
+
+func (r baseRole) CheckMove(g *Game, p *Player, target *Player) error {
+	return nil
+}
+
+func (r baseRole) ResolveNight(n *NightResolution, a *PlannedNightAction) error {
+	return resolveDefault(n, a)
+}
+
+func (r baseRole) Investigate(n *NightResolution, target *Player) (interface{}, error) {
+	return nil, nil
+}
+
+func (r baseRole) KnowsRole(other Role) bool {
+	return false
+}
+
+func (r baseRole) Suspicious() bool {
+	return r.team == MafiaTeam
+}
+
+func (r baseRole) WinCondition() WinCondition {
+	return r.team.Win
+}
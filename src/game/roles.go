@@ -0,0 +1,357 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// IDs of the built in roles
+// these are stored in the database so they cannot change
+const (
+	VillagerRole uint = 1
+	MafiaRole    uint = 2
+	DoctorRole   uint = 3
+	SherriffRole uint = 4
+
+	JesterRole       uint = 5
+	SerialKillerRole uint = 6
+	SurvivorRole     uint = 7
+
+	VigilanteRole   uint = 8
+	BodyguardRole   uint = 9
+	RoleblockerRole uint = 10
+	TrackerRole     uint = 11
+	LookoutRole     uint = 12
+
+	GodfatherRole uint = 13
+	FramerRole    uint = 14
+	JanitorRole   uint = 15
+	ConsortRole   uint = 16
+)
+
+func init() {
+	RegisterRole(villager{baseRole{VillagerRole, "Villager", TownTeam}})
+	RegisterRole(mafia{mafiaBase{baseRole{MafiaRole, "Mafia", MafiaTeam}}})
+	RegisterRole(doctor{baseRole{DoctorRole, "Doctor", TownTeam}})
+	RegisterRole(sherriff{baseRole{SherriffRole, "Sherriff", TownTeam}})
+
+	RegisterRole(jester{baseRole{JesterRole, "Jester", NeutralTeam}})
+	RegisterRole(serialKiller{baseRole{SerialKillerRole, "SerialKiller", SerialKillerTeam}})
+	RegisterRole(survivor{baseRole{SurvivorRole, "Survivor", NeutralTeam}})
+
+	RegisterRole(vigilante{baseRole{VigilanteRole, "Vigilante", TownTeam}})
+	RegisterRole(bodyguard{baseRole{BodyguardRole, "Bodyguard", TownTeam}})
+	RegisterRole(roleblocker{baseRole{RoleblockerRole, "Roleblocker", TownTeam}})
+	RegisterRole(tracker{baseRole{TrackerRole, "Tracker", TownTeam}})
+	RegisterRole(lookout{baseRole{LookoutRole, "Lookout", TownTeam}})
+
+	RegisterRole(godfather{mafiaBase{baseRole{GodfatherRole, "Godfather", MafiaTeam}}})
+	RegisterRole(framer{mafiaBase{baseRole{FramerRole, "Framer", MafiaTeam}}})
+	RegisterRole(janitor{mafiaBase{baseRole{JanitorRole, "Janitor", MafiaTeam}}})
+	RegisterRole(consort{mafiaBase{baseRole{ConsortRole, "Consort", MafiaTeam}}})
+}
+
+// villagers have no night action and fill every spot left over
+type villager struct {
+	baseRole
+}
+
+func (r villager) Count(o *GameOptions) uint {
+	return o.VillagerCount()
+}
+
+// mafiaBase has what every mafia role shares, knowing who the rest of the mafia are
+type mafiaBase struct {
+	baseRole
+}
+
+func (r mafiaBase) KnowsRole(other Role) bool {
+	return other.Team() == MafiaTeam
+}
+
+// mafia vote together on who to kill
+type mafia struct {
+	mafiaBase
+}
+
+func (r mafia) Count(o *GameOptions) uint {
+	return o.MafiaCount
+}
+
+func (r mafia) NightAction() NightAction {
+	return NightAction{Kind: KillAction, Collective: true}
+}
+
+// doctors vote together on who to save
+type doctor struct {
+	baseRole
+}
+
+func (r doctor) Count(o *GameOptions) uint {
+	return o.DoctorCount
+}
+
+func (r doctor) NightAction() NightAction {
+	return NightAction{Kind: ProtectAction, Collective: true}
+}
+
+// sherriffs find out at the end of the night whether their target is mafia
+// and cannot take it back
+type sherriff struct {
+	baseRole
+}
+
+func (r sherriff) Count(o *GameOptions) uint {
+	return o.SherriffCount
+}
+
+func (r sherriff) NightAction() NightAction {
+	return NightAction{Kind: InvestigateAction, Final: true}
+}
+
+// a framed target looks guilty whatever their role
+func (r sherriff) Investigate(n *NightResolution, target *Player) (interface{}, error) {
+	if n.IsFramed(target) {
+		return true, nil
+	}
+	role := target.Role()
+	return role != nil && role.Suspicious(), nil
+}
+
+// jesters have no night action and win by getting themselves lynched
+type jester struct {
+	baseRole
+}
+
+func (r jester) Count(o *GameOptions) uint {
+	return o.JesterCount
+}
+
+func (r jester) WinCondition() WinCondition {
+	return lynchedWin{}
+}
+
+// serial killers kill alone each night and win by being the last one alive
+type serialKiller struct {
+	baseRole
+}
+
+func (r serialKiller) Count(o *GameOptions) uint {
+	return o.SerialKillerCount
+}
+
+func (r serialKiller) NightAction() NightAction {
+	return NightAction{Kind: KillAction}
+}
+
+// survivors have no night action and win by staying alive until the game ends
+type survivor struct {
+	baseRole
+}
+
+func (r survivor) Count(o *GameOptions) uint {
+	return o.SurvivorCount
+}
+
+func (r survivor) WinCondition() WinCondition {
+	return surviveWin{}
+}
+
+// nights a vigilante can shoot on
+const vigilanteShots = 2
+
+// vigilantes kill alone, but only on a few nights
+// a shot is spent on every night they pick a target, even if they were blocked
+type vigilante struct {
+	baseRole
+}
+
+func (r vigilante) Count(o *GameOptions) uint {
+	return o.VigilanteCount
+}
+
+func (r vigilante) NightAction() NightAction {
+	return NightAction{Kind: KillAction}
+}
+
+func (r vigilante) CheckMove(g *Game, p *Player, target *Player) error {
+	if g.shotsTaken(p) >= vigilanteShots {
+		return errors.New(fmt.Sprintf("Vigilante has used all %d shots", vigilanteShots))
+	}
+	return nil
+}
+
+// counts the nights before this one that a player picked a kill target
+func (g *Game) shotsTaken(p *Player) uint {
+	var shots uint
+	for _, move := range g.Moves {
+		if move.PlayerID == p.PlayerID && move.TurnCount < g.TurnCount && move.Type == VigilanteRole && move.TargetID != 0 {
+			shots += 1
+		}
+	}
+	return shots
+}
+
+// bodyguards die in place of their target if the target is attacked, and take the attacker with them
+type bodyguard struct {
+	baseRole
+}
+
+func (r bodyguard) Count(o *GameOptions) uint {
+	return o.BodyguardCount
+}
+
+func (r bodyguard) NightAction() NightAction {
+	return NightAction{Kind: ProtectAction}
+}
+
+func (r bodyguard) CheckMove(g *Game, p *Player, target *Player) error {
+	if target.PlayerID == p.PlayerID {
+		return errors.New("Bodyguard cannot guard themselves")
+	}
+	return nil
+}
+
+func (r bodyguard) ResolveNight(n *NightResolution, a *PlannedNightAction) error {
+	n.Guard(a.Performer(n), a.Target)
+	return nil
+}
+
+// roleblockers stop their target's action for the night
+type roleblocker struct {
+	baseRole
+}
+
+func (r roleblocker) Count(o *GameOptions) uint {
+	return o.RoleblockerCount
+}
+
+func (r roleblocker) NightAction() NightAction {
+	return NightAction{Kind: BlockAction}
+}
+
+// trackers follow their target and learn who they visited
+type tracker struct {
+	baseRole
+}
+
+func (r tracker) Count(o *GameOptions) uint {
+	return o.TrackerCount
+}
+
+func (r tracker) NightAction() NightAction {
+	return NightAction{Kind: InvestigateAction, Priority: WatchPriority}
+}
+
+func (r tracker) ResolveNight(n *NightResolution, a *PlannedNightAction) error {
+	visited := n.Visited(a.Target)
+	message := fmt.Sprintf("%s stayed home", a.Target.Name)
+	if visited != 0 {
+		message = fmt.Sprintf("%s visited %s", a.Target.Name, n.Game.playerName(visited))
+	}
+	n.AddResultData(a.Performer(n), TrackResult, a.Target, message, visited)
+	return nil
+}
+
+// lookouts watch their target's house and learn who visited it
+type lookout struct {
+	baseRole
+}
+
+func (r lookout) Count(o *GameOptions) uint {
+	return o.LookoutCount
+}
+
+func (r lookout) NightAction() NightAction {
+	return NightAction{Kind: InvestigateAction, Priority: WatchPriority}
+}
+
+func (r lookout) ResolveNight(n *NightResolution, a *PlannedNightAction) error {
+	performer := a.Performer(n)
+	visitors := make([]uint, 0)
+	names := make([]string, 0)
+	for _, visitor := range n.Visitors(a.Target) {
+		if visitor != performer.PlayerID {
+			visitors = append(visitors, visitor)
+			names = append(names, n.Game.playerName(visitor))
+		}
+	}
+
+	message := fmt.Sprintf("Nobody visited %s", a.Target.Name)
+	if len(names) != 0 {
+		message = fmt.Sprintf("%s was visited by %s", a.Target.Name, strings.Join(names, ", "))
+	}
+	n.AddResultData(performer, WatchResult, a.Target, message, visitors)
+	return nil
+}
+
+// godfathers vote on the kill with the rest of the mafia but look innocent to investigations
+type godfather struct {
+	mafiaBase
+}
+
+func (r godfather) Count(o *GameOptions) uint {
+	return o.GodfatherCount
+}
+
+func (r godfather) NightAction() NightAction {
+	return NightAction{Kind: KillAction, Collective: true, Joins: MafiaRole}
+}
+
+func (r godfather) Suspicious() bool {
+	return false
+}
+
+// framers make their target look guilty to a sherriff who investigates them that night
+type framer struct {
+	mafiaBase
+}
+
+func (r framer) Count(o *GameOptions) uint {
+	return o.FramerCount
+}
+
+func (r framer) NightAction() NightAction {
+	return NightAction{Kind: FrameAction}
+}
+
+// janitors clean up their target's body if they die, hiding their role and will from everyone else
+// the janitor learns the role themselves
+type janitor struct {
+	mafiaBase
+}
+
+func (r janitor) Count(o *GameOptions) uint {
+	return o.JanitorCount
+}
+
+func (r janitor) NightAction() NightAction {
+	return NightAction{Kind: CleanAction}
+}
+
+func (r janitor) ResolveNight(n *NightResolution, a *PlannedNightAction) error {
+	performer := a.Performer(n)
+	if !n.IsDead(a.Target) {
+		n.AddResult(performer, CleanResult, a.Target, fmt.Sprintf("%s did not die, so there was nothing to clean", a.Target.Name))
+		return nil
+	}
+
+	n.SetReveal(a.Target, CleanedReveal)
+	role := a.Target.Role().Name()
+	n.AddResultData(performer, CleanResult, a.Target, fmt.Sprintf("You cleaned up %s, who was a %s", a.Target.Name, role), role)
+	return nil
+}
+
+// consorts stop their target's action for the night, like a roleblocker for the mafia
+type consort struct {
+	mafiaBase
+}
+
+func (r consort) Count(o *GameOptions) uint {
+	return o.ConsortCount
+}
+
+func (r consort) NightAction() NightAction {
+	return NightAction{Kind: BlockAction}
+}
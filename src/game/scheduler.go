@@ -0,0 +1,122 @@
+package game
+
+import (
+	"log"
+	"sync"
+	"time"
+	"ws"
+)
+
+// how often countdown ticks are broadcast, matches the length of an interval
+const tickPeriod = 15 * time.Second
+
+// every second is broadcast once a stage has this long left
+const finalCountdown = 10 * time.Second
+
+// keeps track of when every timed game's current stage finishes
+// and progresses the game once the deadline passes
+type stageScheduler struct {
+	mutex     sync.Mutex
+	deadlines map[uint]time.Time
+	started   bool
+}
+
+var scheduler = stageScheduler{deadlines: make(map[uint]time.Time)}
+
+// Loads every timed game from the store and starts progressing them
+// games whose deadline passed while the server was down progress right away
+func StartScheduler() error {
+	games, err := store.GetScheduledGames()
+	if err != nil {
+		return err
+	}
+
+	scheduler.mutex.Lock()
+	for gameID, stageFinish := range games {
+		scheduler.deadlines[gameID] = stageFinish
+	}
+	alreadyStarted := scheduler.started
+	scheduler.started = true
+	scheduler.mutex.Unlock()
+
+	if !alreadyStarted {
+		go scheduler.run()
+	}
+	return nil
+}
+
+// sets when the current stage of a game finishes
+// a zero time stops the game from being progressed
+func scheduleGame(gameID uint, stageFinish time.Time) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if stageFinish.IsZero() {
+		delete(scheduler.deadlines, gameID)
+	} else {
+		scheduler.deadlines[gameID] = stageFinish
+	}
+}
+
+func (s *stageScheduler) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		expired := make([]uint, 0)
+		ticks := make(map[uint]uint)
+
+		// broadcasting happens after unlocking so that a slow hub cannot hold up scheduling
+		s.mutex.Lock()
+		for gameID, stageFinish := range s.deadlines {
+			remaining := stageFinish.Sub(now)
+			if remaining <= 0 {
+				expired = append(expired, gameID)
+				delete(s.deadlines, gameID)
+				continue
+			}
+
+			// round up so the countdown reads 15, 14, ... 1 rather than 14, 13, ... 0
+			seconds := (remaining + time.Second - 1) / time.Second
+			if seconds*time.Second <= finalCountdown || (seconds*time.Second)%tickPeriod == 0 {
+				ticks[gameID] = uint(seconds)
+			}
+		}
+		s.mutex.Unlock()
+
+		for gameID, seconds := range ticks {
+			// no hub just means nobody is listening
+			ws.BroadcastTransient(gameID, "Tick", seconds)
+		}
+
+		for _, gameID := range expired {
+			err := progressExpiredGame(gameID)
+			if err != nil {
+				log.Printf("Could not progress game %d: %s", gameID, err)
+				if err != ErrGameNotFound {
+					scheduleGame(gameID, now.Add(tickPeriod)) // try again later
+				}
+			}
+		}
+	}
+}
+
+// progresses a game if its stage is still past its deadline
+func progressExpiredGame(gameID uint) error {
+	_, err := transactGame(gameID, func(g *Game) error {
+		// the stage may have progressed some other way since it was scheduled
+		if g.StageFinish.IsZero() {
+			return nil
+		}
+		if time.Now().Before(g.StageFinish) {
+			stageFinish := g.StageFinish
+			g.afterCommit(func() {
+				scheduleGame(gameID, stageFinish)
+			})
+			return nil
+		}
+
+		log.Printf("Stage finished for game %d", gameID)
+		return g.progressStage()
+	})
+	return err
+}
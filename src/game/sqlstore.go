@@ -0,0 +1,441 @@
+package game
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the parts of *sql.DB and *sql.Tx that the store uses
+type sqlRunner interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Store backed by a database/sql connection
+// MySQL and SQLite share the same queries, dialect is kept for migrations
+type sqlStore struct {
+	db      *sql.DB
+	q       sqlRunner // db, or the transaction when inside Transact
+	inTx    bool
+	dialect string
+}
+
+// Makes a store that uses a MySQL database
+func NewMySQLStore(db *sql.DB) Store {
+	return &sqlStore{db: db, q: db, dialect: "mysql"}
+}
+
+// Makes a store that uses an embedded SQLite database
+func NewSQLiteStore(db *sql.DB) Store {
+	return &sqlStore{db: db, q: db, dialect: "sqlite3"}
+}
+
+// scans a DATETIME column from either driver into a time.Time
+// MySQL hands back bytes while SQLite hands back a parsed time
+type sqlTime struct {
+	t *time.Time
+}
+
+func (s sqlTime) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+	case time.Time:
+		*s.t = v.UTC()
+	case []byte:
+		*s.t, err = time.Parse(sqlForm, string(v))
+	case string:
+		*s.t, err = time.Parse(sqlForm, v)
+	default:
+		err = errors.New(fmt.Sprintf("Cannot scan %T into a time", src))
+	}
+	return err
+}
+
+// formats a time the way it is stored in the database
+func toSQLTime(t time.Time) string {
+	return t.UTC().Format(sqlForm)
+}
+
+// same as toSQLTime but a zero time is stored as NULL
+func toNullSQLTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return toSQLTime(t)
+}
+
+// same as a string but an empty string is stored as NULL
+func toNullString(str string) interface{} {
+	if str == "" {
+		return nil
+	}
+	return str
+}
+
+func (s *sqlStore) Ping() error {
+	return s.db.Ping()
+}
+
+func (s *sqlStore) Transact(fn func(Store) error) error {
+	// already inside a transaction, so join it
+	if s.inTx {
+		return fn(s)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(&sqlStore{db: s.db, q: tx, inTx: true, dialect: s.dialect})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetCounter(key string) (uint, uint, uint, error) {
+	var count, scale, addConst uint
+	err := s.q.QueryRow("SELECT count, scale, addConst FROM count WHERE type=?", key).Scan(&count, &scale, &addConst)
+	return count, scale, addConst, err
+}
+
+func (s *sqlStore) SetCounter(key string, count uint) error {
+	_, err := s.q.Exec("UPDATE count SET count=? WHERE type=?", count, key)
+	return err
+}
+
+func (s *sqlStore) IDExists(idType string, id uint) (bool, error) {
+	var table, key string
+	if strings.Contains(strings.ToLower(idType), "game") {
+		table = "games"
+		key = "gameid"
+	} else if strings.Contains(strings.ToLower(idType), "player") {
+		table = "players"
+		key = "playerid"
+	} else {
+		return false, errors.New(fmt.Sprintf("Unknown ID type %s", idType))
+	}
+
+	collision := 1
+	err := s.q.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE %s=?)", table, key), id).Scan(&collision)
+	return collision != 0, err
+}
+
+func (s *sqlStore) InsertGame(g *Game) error {
+	encodedOptions, err := g.Options.Encode()
+	if err != nil {
+		return err
+	}
+	result, err := encodeResult(g.Result)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.q.Exec("INSERT INTO games (gameid, stage, started, modified, stagefinish, turncount, options, moderatorsecret, paused, pauseremaining, joincode, runoff, accused, result) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		g.GameID, g.Stage, toSQLTime(g.Started), toSQLTime(g.Modified), toNullSQLTime(g.StageFinish), g.TurnCount, encodedOptions, g.moderatorSecret, g.Paused, g.PauseRemaining, toNullString(g.JoinCode), encodeRunoff(g.Runoff), g.Accused, toNullString(result))
+	return err
+}
+
+func (s *sqlStore) UpdateGame(g *Game) error {
+	encodedOptions, err := g.Options.Encode()
+	if err != nil {
+		return err
+	}
+	result, err := encodeResult(g.Result)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.q.Exec("UPDATE games SET stage=?, started=?, modified=?, stagefinish=?, turncount=?, options=?, paused=?, pauseremaining=?, joincode=?, runoff=?, accused=?, result=? WHERE gameid=?",
+		g.Stage, toSQLTime(g.Started), toSQLTime(g.Modified), toNullSQLTime(g.StageFinish), g.TurnCount, encodedOptions, g.Paused, g.PauseRemaining, toNullString(g.JoinCode), encodeRunoff(g.Runoff), g.Accused, toNullString(result), g.GameID)
+	return err
+}
+
+func (s *sqlStore) GetGame(gameID uint) (*Game, error) {
+	var game Game
+	game.GameID = gameID
+
+	var encodedOptions string
+	var joinCode sql.NullString
+	var runoff string
+	var result sql.NullString
+
+	err := s.q.QueryRow("SELECT stage, started, modified, stagefinish, turncount, options, moderatorsecret, paused, pauseremaining, joincode, runoff, accused, result FROM games WHERE gameid=?", gameID).Scan(&game.Stage, sqlTime{&game.Started}, sqlTime{&game.Modified}, sqlTime{&game.StageFinish}, &game.TurnCount, &encodedOptions, &game.moderatorSecret, &game.Paused, &game.PauseRemaining, &joinCode, &runoff, &game.Accused, &result)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrGameNotFound
+		}
+		return nil, err
+	}
+
+	options, err := DecodeGameOptions(encodedOptions)
+	if err != nil {
+		return nil, err
+	}
+	game.Options = *options
+	game.JoinCode = joinCode.String
+	game.Runoff, err = decodeRunoff(runoff)
+	if err != nil {
+		return nil, err
+	}
+	game.Result, err = decodeResult(result.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return &game, nil
+}
+
+func (s *sqlStore) GetJoinCodeGame(joinCode string) (uint, error) {
+	var gameID uint
+	err := s.q.QueryRow("SELECT gameid FROM games WHERE joincode=?", joinCode).Scan(&gameID)
+	if err == sql.ErrNoRows {
+		return 0, ErrGameNotFound
+	}
+	return gameID, err
+}
+
+func (s *sqlStore) GetAllGames() ([]uint, error) {
+	games := make([]uint, 0)
+
+	rows, err := s.q.Query("SELECT gameid FROM games ORDER BY modified DESC")
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var gameID uint
+		if err := rows.Scan(&gameID); err != nil {
+			return nil, err
+		}
+		games = append(games, gameID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+func (s *sqlStore) GetScheduledGames() (map[uint]time.Time, error) {
+	games := make(map[uint]time.Time)
+
+	rows, err := s.q.Query("SELECT gameid, stagefinish FROM games WHERE stagefinish IS NOT NULL")
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var gameID uint
+		var stageFinish time.Time
+		if err := rows.Scan(&gameID, sqlTime{&stageFinish}); err != nil {
+			return nil, err
+		}
+		games[gameID] = stageFinish
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+func (s *sqlStore) InsertPlayer(p *Player) error {
+	_, err := s.q.Exec("INSERT INTO players (gameid, playerid, name, role, alive, secret, ready, will, lastwords, reveal, cause) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.GameID, p.PlayerID, p.Name, p.role, p.Alive, p.secret, p.Ready, p.will, p.LastWords, p.reveal, p.cause)
+	return err
+}
+
+func (s *sqlStore) UpdatePlayer(p *Player) error {
+	_, err := s.q.Exec("UPDATE players SET name=?, role=?, alive=?, secret=?, ready=?, will=?, lastwords=?, reveal=?, cause=? WHERE gameid=? AND playerid=?",
+		p.Name, p.role, p.Alive, p.secret, p.Ready, p.will, p.LastWords, p.reveal, p.cause, p.GameID, p.PlayerID)
+	return err
+}
+
+func (s *sqlStore) DeletePlayer(p *Player) error {
+	_, err := s.q.Exec("DELETE FROM players WHERE gameid=? AND playerid=?", p.GameID, p.PlayerID)
+	return err
+}
+
+func (s *sqlStore) GetGamePlayers(gameID uint) (Players, error) {
+	players := make(Players, 0)
+
+	rows, err := s.q.Query("SELECT playerid, name, role, alive, secret, ready, will, lastwords, reveal, cause FROM players WHERE gameid=?", gameID)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var player Player
+		player.GameID = gameID
+		if err := rows.Scan(&player.PlayerID, &player.Name, &player.role, &player.Alive, &player.secret, &player.Ready, &player.will, &player.LastWords, &player.reveal, &player.cause); err != nil {
+			return nil, err
+		}
+		players = append(players, &player)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(players)
+
+	return players, nil
+}
+
+func (s *sqlStore) InsertMove(m *Move) error {
+	_, err := s.q.Exec("INSERT INTO moves (gameid, turncount, playerid, targetid, type, time) VALUES (?, ?, ?, ?, ?, ?)",
+		m.GameID, m.TurnCount, m.PlayerID, m.TargetID, m.Type, toSQLTime(m.Time))
+	return err
+}
+
+func (s *sqlStore) UpdateMove(m *Move) error {
+	_, err := s.q.Exec("UPDATE moves SET targetid=?, type=?, time=? WHERE gameid=? AND playerid=? AND turncount=?",
+		m.TargetID, m.Type, toSQLTime(m.Time), m.GameID, m.PlayerID, m.TurnCount)
+	return err
+}
+
+func (s *sqlStore) GetMoves(gameID uint, filter MoveFilter) (Moves, error) {
+	query := "SELECT turncount, playerid, targetid, type, time FROM moves WHERE gameid=?"
+	args := []interface{}{gameID}
+
+	if filter.PlayerID != 0 {
+		query += " AND playerid=?"
+		args = append(args, filter.PlayerID)
+	}
+	if filter.TurnCount != 0 {
+		query += " AND turncount=?"
+		args = append(args, filter.TurnCount)
+	}
+
+	moves := make(Moves, 0)
+
+	rows, err := s.q.Query(query, args...)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var move Move
+		move.GameID = gameID
+		if err := rows.Scan(&move.TurnCount, &move.PlayerID, &move.TargetID, &move.Type, sqlTime{&move.Time}); err != nil {
+			return nil, err
+		}
+		moves = append(moves, &move)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(moves)
+
+	return moves, nil
+}
+
+func (s *sqlStore) InsertChatMessage(m *ChatMessage) error {
+	result, err := s.q.Exec("INSERT INTO chat (gameid, channel, playerid, turncount, text, time) VALUES (?, ?, ?, ?, ?, ?)",
+		m.GameID, m.Channel, m.PlayerID, m.TurnCount, m.Text, toSQLTime(m.Time))
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = uint(id)
+	return nil
+}
+
+func (s *sqlStore) GetChatMessages(gameID uint, channel string, before uint, limit int) ([]*ChatMessage, error) {
+	messages := make([]*ChatMessage, 0)
+
+	query := "SELECT id, playerid, turncount, text, time FROM chat WHERE gameid=? AND channel=?"
+	args := []interface{}{gameID, channel}
+	if before != 0 {
+		query += " AND id<?"
+		args = append(args, before)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.q.Query(query, args...)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		m := ChatMessage{GameID: gameID, Channel: channel}
+		if err := rows.Scan(&m.ID, &m.PlayerID, &m.TurnCount, &m.Text, sqlTime{&m.Time}); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// the game's lock keeps two transactions from picking the same seq
+func (s *sqlStore) InsertGameEvent(e *GameEvent) error {
+	var seq uint
+	err := s.q.QueryRow("SELECT COALESCE(MAX(seq), 0) FROM history WHERE gameid=?", e.GameID).Scan(&seq)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.q.Exec("INSERT INTO history (gameid, seq, type, data, time) VALUES (?, ?, ?, ?, ?)",
+		e.GameID, seq+1, e.Type, string(e.Data), toSQLTime(e.Time))
+	if err != nil {
+		return err
+	}
+	e.Seq = seq + 1
+	return nil
+}
+
+func (s *sqlStore) GetGameEvents(gameID uint) ([]*GameEvent, error) {
+	events := make([]*GameEvent, 0)
+
+	rows, err := s.q.Query("SELECT seq, type, data, time FROM history WHERE gameid=? ORDER BY seq", gameID)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		e := GameEvent{GameID: gameID}
+		var data string
+		if err := rows.Scan(&e.Seq, &e.Type, &data, sqlTime{&e.Time}); err != nil {
+			return nil, err
+		}
+		e.Data = []byte(data)
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,86 @@
+package game
+
+import (
+	"errors"
+	"time"
+)
+
+// Store is the persistence layer used by the game package
+// Games, players, moves and ID counters all go through it so the
+// backing database can be swapped out (MySQL, SQLite, memory)
+type Store interface {
+	// checks that the backing storage is reachable
+	Ping() error
+
+	// runs fn with a store where every change commits together
+	// or not at all if fn returns an error
+	// calling Transact on the store passed to fn joins the same transaction
+	Transact(fn func(Store) error) error
+
+	// ID counters used by getUniqueID
+	// key is "games" or "players"
+	GetCounter(key string) (count, scale, addConst uint, err error)
+	SetCounter(key string, count uint) error
+	// idType is "game" or "player"
+	IDExists(idType string, id uint) (bool, error)
+
+	// games
+	// GetGame only fills in the game row, not Players or Moves
+	InsertGame(g *Game) error
+	UpdateGame(g *Game) error
+	GetGame(gameID uint) (*Game, error)
+	// gets the ID of the game with an open lobby using the join code
+	GetJoinCodeGame(joinCode string) (uint, error)
+	// sorted by most recently modified first
+	GetAllGames() ([]uint, error)
+	// gets the StageFinish of every game with a timed stage
+	GetScheduledGames() (map[uint]time.Time, error)
+
+	// players
+	InsertPlayer(p *Player) error
+	UpdatePlayer(p *Player) error
+	DeletePlayer(p *Player) error
+	// sorted by playerID
+	GetGamePlayers(gameID uint) (Players, error)
+
+	// moves
+	InsertMove(m *Move) error
+	UpdateMove(m *Move) error
+	// sorted by turn count then playerID
+	GetMoves(gameID uint, filter MoveFilter) (Moves, error)
+
+	// chat
+	// InsertChatMessage sets the ID of the message
+	InsertChatMessage(m *ChatMessage) error
+	// newest first, only messages with IDs below before unless before is 0
+	GetChatMessages(gameID uint, channel string, before uint, limit int) ([]*ChatMessage, error)
+
+	// history
+	// InsertGameEvent sets the Seq of the event to the game's next one
+	InsertGameEvent(e *GameEvent) error
+	// sorted by seq
+	GetGameEvents(gameID uint) ([]*GameEvent, error)
+}
+
+// MoveFilter narrows down the moves returned by Store.GetMoves
+// a zero field matches everything
+type MoveFilter struct {
+	PlayerID  uint
+	TurnCount uint
+}
+
+var ErrGameNotFound = errors.New("Game not found")
+
+// store that every function in the game package uses
+var store Store = NewMemoryStore()
+
+// Sets the store used by the game package
+// should be called once before the server starts
+func SetStore(s Store) {
+	store = s
+}
+
+// Gets the store used by the game package
+func GetStore() Store {
+	return store
+}
@@ -0,0 +1,197 @@
+package game
+
+import (
+	"log"
+	"sync"
+	"ws"
+)
+
+// per game locks so that moves and stage changes on a game run one at a time
+type gameLock struct {
+	sync.Mutex
+	refs int // how many goroutines hold or are waiting on the lock
+}
+
+var gameLocksMutex sync.Mutex
+var gameLocks = make(map[uint]*gameLock)
+
+// locks a game and returns the function that unlocks it
+func lockGame(gameID uint) func() {
+	gameLocksMutex.Lock()
+	lock, ok := gameLocks[gameID]
+	if !ok {
+		lock = &gameLock{}
+		gameLocks[gameID] = lock
+	}
+	lock.refs += 1
+	gameLocksMutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		gameLocksMutex.Lock()
+		lock.refs -= 1
+		if lock.refs == 0 {
+			delete(gameLocks, gameID)
+		}
+		gameLocksMutex.Unlock()
+	}
+}
+
+// transaction that a game was loaded in
+type gameTx struct {
+	store   Store
+	pending []func() // run once the transaction commits
+}
+
+// gets the store the game should read and write through
+func (g *Game) db() Store {
+	if g.tx != nil {
+		return g.tx.store
+	}
+	return store
+}
+
+// runs fn once the game's transaction commits
+// runs fn straight away if the game is not in a transaction
+func (g *Game) afterCommit(fn func()) {
+	if g.tx != nil {
+		g.tx.pending = append(g.tx.pending, fn)
+		return
+	}
+	fn()
+}
+
+// broadcasts an event on the game's hub once the game's transaction commits
+// so that clients never hear about changes that were rolled back
+func (g *Game) broadcastEvent(eventType string, data interface{}) {
+	gameID := g.GameID
+	g.afterCommit(func() {
+		err := ws.BroadcastEvent(gameID, eventType, data)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// sends an event to one player once the game's transaction commits
+func (g *Game) sendToPlayer(playerID uint, eventType string, data interface{}) {
+	gameID := g.GameID
+	g.afterCommit(func() {
+		err := ws.SendToPlayer(gameID, playerID, eventType, data)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// closes a player's websocket connections once the game's transaction commits
+// so whoever lost the seat stops seeing its private events and acting as it
+func (g *Game) dropPlayer(playerID uint) {
+	gameID := g.GameID
+	g.afterCommit(func() {
+		err := ws.DropPlayer(gameID, playerID)
+		if err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// gets the PlayerID of everyone in the game, who each get their own view
+func (g *Game) playerIDs() []uint {
+	ids := make([]uint, 0, len(g.Players))
+	for _, p := range g.Players {
+		ids = append(ids, p.PlayerID)
+	}
+	return ids
+}
+
+// sends every connection on the game's hub its own view of the game once it commits
+func (g *Game) broadcastView() {
+	g.afterCommit(func() {
+		err := ws.BroadcastState(g.GameID, "Game", g.playerIDs(), func(playerID uint, moderator bool) interface{} {
+			return g.View(Viewer{PlayerID: playerID, Moderator: moderator})
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// sends a chat message to every connection on the game's hub that can read its channel
+func (g *Game) broadcastChat(m *ChatMessage) {
+	g.afterCommit(func() {
+		err := ws.BroadcastView(g.GameID, "Chat", g.playerIDs(), func(playerID uint, moderator bool) interface{} {
+			if !g.CanReadChannel(Viewer{PlayerID: playerID, Moderator: moderator}, m.Channel) {
+				return nil
+			}
+			return m
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// lets the game's hub be reaped once the game is over and committed
+func (g *Game) finishHub() {
+	gameID := g.GameID
+	g.afterCommit(func() {
+		ws.FinishHub(gameID)
+	})
+}
+
+// Loads a game while holding its lock and runs fn on it inside of a transaction
+// everything fn writes commits together or not at all
+// returns the game as it was committed and sends its new view to the hub
+func transactGame(gameID uint, fn func(g *Game) error) (*Game, error) {
+	unlock := lockGame(gameID)
+	defer unlock()
+
+	var g *Game
+	err := store.Transact(func(s Store) error {
+		var err error
+		g, err = getGame(s, gameID)
+		if err != nil {
+			return err
+		}
+		g.tx = &gameTx{store: s}
+		err = fn(g)
+		if err != nil {
+			return err
+		}
+		g.broadcastView()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pending := g.tx.pending
+	g.tx = nil
+	for _, fn := range pending {
+		fn()
+	}
+
+	return g, nil
+}
+
+// same as transactGame for a game that has already been loaded
+// the game is reloaded first so fn never acts on stale state
+// and g is replaced with the committed game afterwards
+func (g *Game) transact(fn func(g *Game) error) error {
+	// already inside of a transaction on this game
+	if g.tx != nil {
+		return fn(g)
+	}
+
+	committed, err := transactGame(g.GameID, fn)
+	if err != nil {
+		return err
+	}
+
+	*g = *committed
+	return nil
+}
@@ -0,0 +1,178 @@
+package game
+
+import (
+	"errors"
+)
+
+// stages that follow a nomination on a day held with trials, picked with GameOptions.Trials
+// the day itself (stage 2) is for nominating, which is a vote move for the nominee
+const (
+	DefenseStage  = 3 // the accused defends themselves, only they can talk in the Town channel
+	JudgmentStage = 4 // everyone else votes guilty, innocent or abstain on the accused
+)
+
+// move types of judgment votes, kept apart from role IDs as those are the night's move types
+const (
+	GuiltyVote   uint = 100
+	InnocentVote uint = 101
+	AbstainVote  uint = 102
+)
+
+// TrialEvent is sent with the Trial websocket event whenever a trial moves on
+// the votes are only filled in with the verdict
+type TrialEvent struct {
+	Action   string // "Defense", "Judgment", "Guilty" or "Innocent"
+	PlayerID uint   // the accused
+	Guilty   uint   `json:",omitempty"`
+	Innocent uint   `json:",omitempty"`
+	Abstain  uint   `json:",omitempty"`
+}
+
+// Whether it is day, including the stages of a trial
+func (g *Game) IsDay() bool {
+	return g.Stage == 2 || g.Stage == DefenseStage || g.Stage == JudgmentStage
+}
+
+// whether the day is held with nominations and trials
+func (g *Game) hasTrials() bool {
+	return g.Options.Trials != 0
+}
+
+func isJudgmentVote(moveType uint) bool {
+	return moveType == GuiltyVote || moveType == InnocentVote || moveType == AbstainVote
+}
+
+// whether the stage waits on a player's move before it can end early
+// only the accused moves in their defense, and everyone else in their judgment
+func (g *Game) mustMove(p *Player) bool {
+	if !p.Alive {
+		return false
+	}
+	switch g.Stage {
+	case DefenseStage:
+		return p.PlayerID == g.Accused
+	case JudgmentStage:
+		return p.PlayerID != g.Accused
+	}
+	return true
+}
+
+// checks a move made during a day held with trials
+// the accused moves in their defense to rest their case
+func (g *Game) checkTrialMove(p *Player, targetID uint, moveType uint) error {
+	switch g.Stage {
+	case 2:
+		if moveType != 0 {
+			return errors.New("Invalid move type, not a nomination")
+		}
+		if targetID == p.PlayerID {
+			return errors.New("Players cannot nominate themselves")
+		}
+		if target, _ := g.FindPlayerWithID(targetID); target != nil && !target.Alive {
+			return errors.New("Dead players cannot be nominated")
+		}
+	case DefenseStage:
+		if p.PlayerID != g.Accused {
+			return errors.New("Only the accused can move during the defense")
+		}
+	case JudgmentStage:
+		if p.PlayerID == g.Accused {
+			return errors.New("The accused cannot vote in their own judgment")
+		}
+		if !isJudgmentVote(moveType) {
+			return errors.New("Invalid move type, not a judgment vote")
+		}
+		if targetID != g.Accused {
+			return errors.New("Judgment votes have to target the accused")
+		}
+	}
+	return nil
+}
+
+// gets the player nominated by one player and seconded by enough others to go on trial
+// 0 if nobody has been, a nomination of TargetID 0 nominates nobody
+func nominee(moves Moves, seconds uint) uint {
+	counts := make(map[uint]uint)
+	for _, move := range moves {
+		if move.Type == 0 && move.TargetID != 0 {
+			counts[move.TargetID] += 1
+		}
+	}
+	ranked := rankVotes(counts)
+	if len(ranked) != 0 && ranked[0].count > seconds {
+		return ranked[0].targetID
+	}
+	return 0
+}
+
+// ends the nominations, putting the nominee on trial or going to night without a lynch
+func (g *Game) processNominations() (int, error) {
+	moves, err := g.db().GetMoves(g.GameID, MoveFilter{TurnCount: g.TurnCount})
+	if err != nil {
+		return 0, err
+	}
+
+	accused := nominee(moves, g.Options.NominationSeconds)
+	if accused == 0 {
+		g.endDay(nil)
+		return 3, nil // 3 for no kill
+	}
+
+	g.Accused = accused
+	g.Stage = DefenseStage
+	g.StageFinish = stageDeadline(g.Options.DefenseIntervals)
+	g.broadcastEvent("Trial", TrialEvent{Action: "Defense", PlayerID: accused})
+	return 5, nil // 5 for a trial
+}
+
+// ends the defense and opens the judgment
+func (g *Game) processDefense() {
+	g.Stage = JudgmentStage
+	g.StageFinish = stageDeadline(g.Options.JudgmentIntervals)
+	g.broadcastEvent("Trial", TrialEvent{Action: "Judgment", PlayerID: g.Accused})
+}
+
+// counts the judgment, lynching the accused if more voted guilty than innocent
+// an acquittal goes back to nominating with a new day timer
+func (g *Game) processJudgment() (int, error) {
+	moves, err := g.db().GetMoves(g.GameID, MoveFilter{TurnCount: g.TurnCount})
+	if err != nil {
+		return 0, err
+	}
+
+	event := TrialEvent{PlayerID: g.Accused}
+	for _, move := range moves {
+		switch move.Type {
+		case GuiltyVote:
+			event.Guilty += 1
+		case InnocentVote:
+			event.Innocent += 1
+		case AbstainVote:
+			event.Abstain += 1
+		}
+	}
+
+	accused, err := g.FindPlayerWithID(g.Accused)
+	if err != nil {
+		return 0, err
+	}
+	g.Accused = 0
+
+	// the moderator may have killed the accused during the trial
+	if event.Guilty > event.Innocent && accused.Alive {
+		event.Action = "Guilty"
+		g.broadcastEvent("Trial", event)
+		_, err = g.lynch(accused.PlayerID)
+		if err != nil {
+			return 0, err
+		}
+		g.endDay(accused)
+		return 1, nil // 1 for successful kill
+	}
+
+	event.Action = "Innocent"
+	g.broadcastEvent("Trial", event)
+	g.Stage = 2
+	g.StageFinish = stageDeadline(g.Options.DayTimeIntervals)
+	return 3, nil // 3 for no kill
+}
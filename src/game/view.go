@@ -0,0 +1,147 @@
+package game
+
+import (
+	"time"
+)
+
+// Viewer is who a view of a game is built for
+// a zero Viewer is an anonymous spectator
+type Viewer struct {
+	PlayerID  uint // 0 for spectators and the moderator
+	Moderator bool
+}
+
+// PlayerView is a player as a viewer sees them
+// Role and Team are only filled in when the viewer knows them or they were revealed on death
+type PlayerView struct {
+	PlayerID uint
+	Name     string
+	Alive    bool
+	Ready    bool
+	Role     string `json:",omitempty"`
+	Team     string `json:",omitempty"`
+	// the will is only filled in once the player dies, unless the viewer is them
+	// a janitor's victim's will is only filled in for janitors
+	Will      string `json:",omitempty"`
+	LastWords string `json:",omitempty"`
+}
+
+// GameView is the part of a game a viewer is allowed to see
+type GameView struct {
+	GameID         uint
+	JoinCode       string `json:",omitempty"`
+	Stage          int
+	Started        time.Time
+	Modified       time.Time
+	StageFinish    time.Time
+	TurnCount      uint
+	Paused         bool
+	PauseRemaining uint
+	Runoff         []uint      `json:",omitempty"`
+	Accused        uint        `json:",omitempty"`
+	Result         *GameResult `json:",omitempty"`
+	Options        GameOptions
+	Players        []PlayerView
+	Moves          Moves
+}
+
+// whether the viewer can see everything in the game
+func (g *Game) seesAll(v Viewer) bool {
+	return v.Moderator || g.IsOver()
+}
+
+// gets the role of the player viewing, nil for spectators or players without a role
+func (g *Game) viewerRole(v Viewer) Role {
+	p := g.viewerPlayer(v)
+	if p == nil {
+		return nil
+	}
+	return p.Role()
+}
+
+// whether the viewer knows the player's role
+// players know their own role and mafia know their teammates'
+func (g *Game) knowsRole(v Viewer, p *Player) bool {
+	if p.Role() == nil {
+		return false
+	}
+	if g.seesAll(v) || (v.PlayerID != 0 && v.PlayerID == p.PlayerID) {
+		return true
+	}
+	role := g.viewerRole(v)
+	return role != nil && role.KnowsRole(p.Role())
+}
+
+// whether the viewer can read the player's will
+// everyone reads it once the player dies, other than the will of a cleaned body, which only janitors read
+func (g *Game) readsWill(v Viewer, p *Player) bool {
+	if g.seesAll(v) || (v.PlayerID != 0 && v.PlayerID == p.PlayerID) {
+		return true
+	}
+	if p.Alive {
+		return false
+	}
+	if p.reveal != CleanedReveal {
+		return true
+	}
+	role := g.viewerRole(v)
+	return role != nil && role.NightAction().Kind == CleanAction
+}
+
+// whether the viewer can see a move
+// day votes and judgment votes are public, night moves are only seen by whoever knows the mover's role
+func (g *Game) seesMove(v Viewer, m *Move) bool {
+	if m.Type == 0 || isJudgmentVote(m.Type) || g.seesAll(v) || (v.PlayerID != 0 && v.PlayerID == m.PlayerID) {
+		return true
+	}
+	p, err := g.FindPlayerWithID(m.PlayerID)
+	if err != nil {
+		return false
+	}
+	return g.knowsRole(v, p)
+}
+
+// Builds what a viewer is allowed to see of the game
+// roles and night moves stay hidden until the game is over
+// unless the viewer is the moderator, the player themselves or a teammate
+func (g *Game) View(v Viewer) *GameView {
+	view := GameView{
+		GameID:         g.GameID,
+		JoinCode:       g.JoinCode,
+		Stage:          g.Stage,
+		Started:        g.Started,
+		Modified:       g.Modified,
+		StageFinish:    g.StageFinish,
+		TurnCount:      g.TurnCount,
+		Paused:         g.Paused,
+		PauseRemaining: g.PauseRemaining,
+		Runoff:         g.Runoff,
+		Accused:        g.Accused,
+		Result:         g.Result,
+		Options:        g.Options,
+		Players:        make([]PlayerView, 0, len(g.Players)),
+		Moves:          make(Moves, 0, len(g.Moves)),
+	}
+
+	for _, p := range g.Players {
+		pv := PlayerView{PlayerID: p.PlayerID, Name: p.Name, Alive: p.Alive, Ready: p.Ready, LastWords: p.LastWords}
+		if g.readsWill(v, p) {
+			pv.Will = p.will
+		}
+		if g.knowsRole(v, p) {
+			pv.Role = p.Role().Name()
+			pv.Team = p.Role().Team().Name
+		} else {
+			pv.Role, pv.Team = p.revealed()
+		}
+		view.Players = append(view.Players, pv)
+	}
+
+	for _, m := range g.Moves {
+		if g.seesMove(v, m) {
+			view.Moves = append(view.Moves, m)
+		}
+	}
+
+	return &view
+}
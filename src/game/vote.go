@@ -0,0 +1,172 @@
+package game
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ways of counting the day's lynch votes, picked with GameOptions.VotingSystem
+// a vote for TargetID 0 is a vote to lynch nobody
+const (
+	PluralityVoting uint = iota // the most votes is lynched, a tie lynches nobody
+	MajorityVoting              // only lynched with votes from more than half of the living players
+	RandomTieVoting             // the most votes is lynched, a tie is broken at random
+	RunoffVoting                // without more than half of the votes cast the top two go to a runoff
+)
+
+var VotingSystemNames = []string{"Plurality", "Majority", "RandomTie", "Runoff"}
+
+// VoteTally is the outcome of counting a day's votes
+type VoteTally struct {
+	Counts   map[uint]uint // votes for each target
+	Decided  bool          // whether the votes picked a target, which may be nobody
+	TargetID uint          // player lynched, 0 for nobody
+	Runoff   []uint        // targets that go to a runoff, only when one is needed
+}
+
+// votes for one target
+type voteCount struct {
+	targetID uint
+	count    uint
+}
+
+// sorts the targets by most votes and then by lowest TargetID
+// so that nothing depends on the order of iterating over a map
+func rankVotes(counts map[uint]uint) []voteCount {
+	ranked := make([]voteCount, 0, len(counts))
+	for targetID, count := range counts {
+		ranked = append(ranked, voteCount{targetID, count})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].count != ranked[j].count {
+			return ranked[i].count > ranked[j].count
+		}
+		return ranked[i].targetID < ranked[j].targetID
+	})
+	return ranked
+}
+
+// gets the targets with at least count votes, lowest TargetID first
+func votedAtLeast(ranked []voteCount, count uint) []uint {
+	targets := make([]uint, 0)
+	for _, v := range ranked {
+		if v.count >= count {
+			targets = append(targets, v.targetID)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+	return targets
+}
+
+// Counts the day votes in moves with a voting system
+// living is the number of living players, runoff is the targets of a runoff being voted on
+// seed picks the winner of a random tie-break, so the same votes and seed always give the same tally
+func TallyVotes(system uint, moves Moves, living uint, runoff []uint, seed int64) VoteTally {
+	tally := VoteTally{Counts: make(map[uint]uint)}
+	var cast uint
+	for _, move := range moves {
+		if move.Type == 0 {
+			tally.Counts[move.TargetID] += 1
+			cast += 1
+		}
+	}
+
+	ranked := rankVotes(tally.Counts)
+	if len(ranked) == 0 {
+		return tally
+	}
+	top := ranked[0]
+	tied := votedAtLeast(ranked, top.count)
+
+	// a runoff is decided by the most votes, and a tie in it lynches nobody
+	if len(runoff) != 0 {
+		system = PluralityVoting
+	}
+
+	switch system {
+	case MajorityVoting:
+		if top.count*2 > living {
+			tally.Decided = true
+			tally.TargetID = top.targetID
+		}
+
+	case RandomTieVoting:
+		tally.Decided = true
+		tally.TargetID = tied[rand.New(rand.NewSource(seed)).Intn(len(tied))]
+
+	case RunoffVoting:
+		if top.count*2 > cast {
+			tally.Decided = true
+			tally.TargetID = top.targetID
+		} else {
+			// everyone tied for first or second place goes through
+			second := ranked[1].count
+			tally.Runoff = votedAtLeast(ranked, second)
+		}
+
+	default:
+		if len(tied) == 1 {
+			tally.Decided = true
+			tally.TargetID = top.targetID
+		}
+	}
+
+	return tally
+}
+
+// seed for the day's random tie-break, the same every time the turn is counted
+func (g *Game) voteSeed() int64 {
+	return int64(g.GameID)<<32 | int64(g.TurnCount)
+}
+
+// counts the players that are still alive
+func (g *Game) livingCount() uint {
+	var count uint
+	for _, p := range g.Players {
+		if p.Alive {
+			count += 1
+		}
+	}
+	return count
+}
+
+// whether a target can be voted for in the runoff being held
+// a vote for nobody is always allowed
+func (g *Game) inRunoff(targetID uint) bool {
+	if targetID == 0 {
+		return true
+	}
+	for _, id := range g.Runoff {
+		if id == targetID {
+			return true
+		}
+	}
+	return false
+}
+
+// writes the targets of a runoff for storing, like "1,2"
+func encodeRunoff(runoff []uint) string {
+	ids := make([]string, 0, len(runoff))
+	for _, id := range runoff {
+		ids = append(ids, strconv.FormatUint(uint64(id), 10))
+	}
+	return strings.Join(ids, ",")
+}
+
+// reads the targets of a runoff written by encodeRunoff
+func decodeRunoff(encoded string) ([]uint, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	runoff := make([]uint, 0)
+	for _, id := range strings.Split(encoded, ",") {
+		parsed, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		runoff = append(runoff, uint(parsed))
+	}
+	return runoff, nil
+}
@@ -0,0 +1,96 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+// a day vote for each target, in order
+func votes(targets ...uint) Moves {
+	moves := make(Moves, len(targets))
+	for i, target := range targets {
+		moves[i] = &Move{GameID: 1, TurnCount: 2, PlayerID: uint(i + 1), TargetID: target}
+	}
+	return moves
+}
+
+func TestTallyVotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		system   uint
+		moves    Moves
+		living   uint
+		runoff   []uint
+		decided  bool
+		targetID uint
+		next     []uint // targets of the runoff the tally starts
+	}{
+		{"plurality winner", PluralityVoting, votes(7, 7, 8), 3, nil, true, 7, nil},
+		{"plurality tie lynches nobody", PluralityVoting, votes(7, 7, 8, 8), 4, nil, false, 0, nil},
+		{"plurality for nobody", PluralityVoting, votes(0, 0, 8), 3, nil, true, 0, nil},
+		{"no votes", PluralityVoting, votes(), 3, nil, false, 0, nil},
+
+		{"majority reached", MajorityVoting, votes(7, 7, 7, 8), 5, nil, true, 7, nil},
+		{"majority not reached", MajorityVoting, votes(7, 7, 8), 5, nil, false, 0, nil},
+		{"majority of exactly half", MajorityVoting, votes(7, 7, 8), 4, nil, false, 0, nil},
+		{"majority counts the living, not the votes cast", MajorityVoting, votes(7, 7), 5, nil, false, 0, nil},
+
+		{"runoff not needed", RunoffVoting, votes(7, 7, 7, 8), 4, nil, true, 7, nil},
+		{"runoff from a two way tie", RunoffVoting, votes(7, 7, 8, 8), 4, nil, false, 0, []uint{7, 8}},
+		{"runoff from a three way tie", RunoffVoting, votes(9, 8, 7), 3, nil, false, 0, []uint{7, 8, 9}},
+		{"runoff takes everyone tied for second", RunoffVoting, votes(7, 7, 8, 9), 4, nil, false, 0, []uint{7, 8, 9}},
+		{"runoff of exactly half", RunoffVoting, votes(7, 7, 8, 0), 4, nil, false, 0, []uint{0, 7, 8}},
+		{"runoff decided", RunoffVoting, votes(7, 7, 8), 3, []uint{7, 8}, true, 7, nil},
+		{"tie inside the runoff lynches nobody", RunoffVoting, votes(7, 8), 2, []uint{7, 8}, false, 0, nil},
+		{"runoff won by nobody", RunoffVoting, votes(0, 0, 7), 3, []uint{7, 8}, true, 0, nil},
+	}
+
+	for _, test := range tests {
+		tally := TallyVotes(test.system, test.moves, test.living, test.runoff, 1)
+		if tally.Decided != test.decided || tally.TargetID != test.targetID {
+			t.Errorf("%s: got decided %t target %d, want %t %d", test.name, tally.Decided, tally.TargetID, test.decided, test.targetID)
+		}
+		if len(tally.Runoff) != 0 || len(test.next) != 0 {
+			if !reflect.DeepEqual(tally.Runoff, test.next) {
+				t.Errorf("%s: got runoff %v, want %v", test.name, tally.Runoff, test.next)
+			}
+		}
+	}
+}
+
+func TestTallyVotesRandomTie(t *testing.T) {
+	moves := votes(7, 8, 9, 7, 8, 9)
+	seen := make(map[uint]bool)
+	for seed := int64(0); seed < 50; seed++ {
+		first := TallyVotes(RandomTieVoting, moves, 6, nil, seed)
+		again := TallyVotes(RandomTieVoting, moves, 6, nil, seed)
+		if !first.Decided || first.TargetID != again.TargetID {
+			t.Fatalf("seed %d: got %d then %d", seed, first.TargetID, again.TargetID)
+		}
+		if first.TargetID < 7 || first.TargetID > 9 {
+			t.Fatalf("seed %d: lynched %d, who was not tied", seed, first.TargetID)
+		}
+		seen[first.TargetID] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("50 seeds always broke the tie for %v", seen)
+	}
+
+	// a clear winner is never left to chance
+	tally := TallyVotes(RandomTieVoting, votes(7, 7, 8), 3, nil, 3)
+	if tally.TargetID != 7 {
+		t.Errorf("got %d, want 7", tally.TargetID)
+	}
+}
+
+func TestRunoffAllowsNobody(t *testing.T) {
+	g := &Game{Runoff: []uint{7, 8}}
+	for _, test := range []struct {
+		targetID uint
+		allowed  bool
+	}{{7, true}, {8, true}, {9, false}, {0, true}} {
+		if g.inRunoff(test.targetID) != test.allowed {
+			t.Errorf("target %d: got %t, want %t", test.targetID, !test.allowed, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// stage after a lynch where the lynched player gives their last words
+// only held when GameOptions.LastWordsIntervals is set
+const LastWordsStage = 5
+
+// longest will or last words a player can write
+const maxWillLength = 500
+
+// DeathEvent is sent with the Death websocket event
+// the role and team are only there when revealed, and the will and last words if the player wrote any
+// the will of a cleaned body is left out
+type DeathEvent struct {
+	PlayerID  uint
+	Cause     string
+	Role      string `json:",omitempty"`
+	Team      string `json:",omitempty"`
+	Will      string `json:",omitempty"`
+	LastWords string `json:",omitempty"`
+}
+
+// trims a will or last words and checks the length
+func checkWillText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) > maxWillLength {
+		return "", errors.New(fmt.Sprintf("Cannot be longer than %d characters", maxWillLength))
+	}
+	return text, nil
+}
+
+// Sets the will a player leaves behind, which only they can see until they die
+// an empty will clears it
+func (g *Game) SetWill(playerID uint, text string) error {
+	text, err := checkWillText(text)
+	if err != nil {
+		return err
+	}
+
+	return g.transact(func(g *Game) error {
+		if g.IsOver() {
+			return ErrGameOver
+		}
+
+		p, err := g.FindPlayerWithID(playerID)
+		if err != nil {
+			return err
+		}
+		if !p.Alive {
+			return errors.New("Dead players cannot change their will")
+		}
+
+		p.will = text
+		err = g.db().UpdatePlayer(p)
+		if err != nil {
+			return err
+		}
+		err = g.record(EventWill, PlayerData{PlayerID: p.PlayerID, Text: text})
+		if err != nil {
+			return err
+		}
+
+		g.Modified = time.Now().UTC()
+		return g.Update()
+	})
+}
+
+// Gives the lynched player's last words, which ends their last words straight away
+func (g *Game) SetLastWords(playerID uint, text string) error {
+	text, err := checkWillText(text)
+	if err != nil {
+		return err
+	}
+
+	return g.transact(func(g *Game) error {
+		if g.Stage != LastWordsStage || g.Accused != playerID {
+			return errors.New("Only the lynched player can give last words, before the night starts")
+		}
+
+		p, err := g.FindPlayerWithID(playerID)
+		if err != nil {
+			return err
+		}
+
+		p.LastWords = text
+		err = g.db().UpdatePlayer(p)
+		if err != nil {
+			return err
+		}
+		err = g.record(EventLastWords, PlayerData{PlayerID: p.PlayerID, Text: text})
+		if err != nil {
+			return err
+		}
+
+		g.Modified = time.Now().UTC()
+		return g.progressStage()
+	})
+}
+
+// announces a death along with what the player left behind
+func (g *Game) announceDeath(p *Player, cause string) {
+	g.broadcastEvent("Death", deathEvent(p, cause))
+}
+
+// builds what everyone is told about a death
+func deathEvent(p *Player, cause string) DeathEvent {
+	role, team := p.revealed()
+	will := p.will
+	if p.reveal == CleanedReveal {
+		will = ""
+	}
+	return DeathEvent{p.PlayerID, cause, role, team, will, p.LastWords}
+}
+
+// ends the day, giving the lynched player their last words first when the game has them
+// lynched is nil when nobody was lynched
+func (g *Game) endDay(lynched *Player) {
+	if lynched != nil && g.Options.LastWordsIntervals != 0 {
+		// the death is announced once the last words are given
+		g.Accused = lynched.PlayerID
+		g.Stage = LastWordsStage
+		g.StageFinish = stageDeadline(g.Options.LastWordsIntervals)
+		g.broadcastEvent("LastWords", lynched.PlayerID)
+		return
+	}
+	if lynched != nil {
+		g.announceDeath(lynched, DeathLynch)
+	}
+
+	g.Stage = 1
+	g.StageFinish = stageDeadline(g.Options.NightTimeIntervals)
+}
+
+// ends the last words and starts the night
+func (g *Game) processLastWords() {
+	g.skipLastWords()
+	g.Stage = 1
+	g.StageFinish = stageDeadline(g.Options.NightTimeIntervals)
+}
+
+// announces the lynched player's death without waiting any longer for their last words
+func (g *Game) skipLastWords() {
+	if p, err := g.FindPlayerWithID(g.Accused); err == nil {
+		g.announceDeath(p, DeathLynch)
+	}
+	g.Accused = 0
+}
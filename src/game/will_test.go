@@ -0,0 +1,63 @@
+package game
+
+import "testing"
+
+func TestCleanedWill(t *testing.T) {
+	tests := []struct {
+		name    string
+		options GameOptions
+		moves   []nightMove
+		readers map[string]bool // who reads the villager's will once they die
+	}{
+		{
+			name:    "will of a body left alone",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, JanitorCount: 1},
+			moves:   []nightMove{{"Mafia", "Villager", false}},
+			readers: map[string]bool{"Villager2": true, "Mafia": true, "Janitor": true, "": true},
+		},
+		{
+			name:    "will of a cleaned body",
+			options: GameOptions{PlayerCount: 6, MafiaCount: 1, JanitorCount: 1},
+			moves:   []nightMove{{"Mafia", "Villager", false}, {"Janitor", "Villager", false}},
+			readers: map[string]bool{"Villager2": false, "Mafia": false, "Janitor": true, "": false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, labels := startNight(t, test.options)
+			err := g.SetWill(labels["Villager"], "it was the mafia")
+			if err != nil {
+				t.Fatalf("SetWill failed: %v", err)
+			}
+			playNight(t, g, labels, test.moves)
+
+			victim, _ := g.FindPlayerWithID(labels["Villager"])
+			if victim.Alive {
+				t.Fatalf("the villager survived the night")
+			}
+
+			event := deathEvent(victim, DeathNight)
+			if (event.Will != "") != test.readers[""] {
+				t.Errorf("got %q as the will in the death event", event.Will)
+			}
+
+			// an empty label is a spectator
+			for reader, reads := range test.readers {
+				view := g.View(Viewer{PlayerID: labels[reader]})
+				for _, pv := range view.Players {
+					if pv.PlayerID == victim.PlayerID && (pv.Will != "") != reads {
+						t.Errorf("%q got %q as the will, want it read: %v", reader, pv.Will, reads)
+					}
+				}
+			}
+
+			view := g.View(Viewer{Moderator: true})
+			for _, pv := range view.Players {
+				if pv.PlayerID == victim.PlayerID && pv.Will == "" {
+					t.Errorf("the moderator could not read the will")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package game
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// stage of a game nobody could win, like when everyone is dead
+const DrawStage = 14
+
+// WinCondition is how a player wins, declared by their team or their role
+type WinCondition interface {
+	// whether the player has met the condition
+	Met(g *Game, p *Player) bool
+	// whether meeting the condition ends the game
+	// conditions that do not, like surviving, are only checked once the game is over
+	EndsGame() bool
+}
+
+// GameResult is how a game ended and who won it
+type GameResult struct {
+	Stage     int
+	Winner    string   `json:",omitempty"` // team whose win ended the game, empty for a draw or when nobody won
+	Draw      bool     `json:",omitempty"`
+	EndedBy   []string `json:",omitempty"` // teams that ended the game at once in a draw, none of them win
+	PlayerIDs []uint   // every player who won, lowest first
+	Teams     []string // teams of the players who won
+}
+
+// teamWin is met once nobody alive is left to stop the team
+// parity teams also win once they match everyone else alive and none of them can kill,
+// if the game has MafiaParity
+type teamWin struct {
+	parity bool
+}
+
+func (w teamWin) EndsGame() bool {
+	return true
+}
+
+func (w teamWin) Met(g *Game, p *Player) bool {
+	team := p.Role().Team()
+	var own, others, opponents uint
+	killers := false
+	for _, other := range g.Players {
+		role := other.Role()
+		if !other.Alive || role == nil {
+			continue
+		}
+		if role.Team() == team {
+			own += 1
+			continue
+		}
+		others += 1
+		if role.WinCondition().EndsGame() {
+			opponents += 1
+			killers = killers || role.NightAction().Kind == KillAction
+		}
+	}
+
+	if own == 0 {
+		return false
+	}
+	if opponents == 0 {
+		return true
+	}
+	return w.parity && g.Options.MafiaParity != 0 && own >= others && !killers
+}
+
+// lastAliveWin is met by being the only player left alive
+type lastAliveWin struct{}
+
+func (w lastAliveWin) EndsGame() bool {
+	return true
+}
+
+func (w lastAliveWin) Met(g *Game, p *Player) bool {
+	return p.Alive && g.livingCount() == 1
+}
+
+// lynchedWin is met by getting lynched, and the game carries on without the player
+type lynchedWin struct{}
+
+func (w lynchedWin) EndsGame() bool {
+	return false
+}
+
+func (w lynchedWin) Met(g *Game, p *Player) bool {
+	return !p.Alive && p.cause == DeathLynch
+}
+
+// surviveWin is met by being alive when the game ends, alongside whoever else wins
+type surviveWin struct{}
+
+func (w surviveWin) EndsGame() bool {
+	return false
+}
+
+func (w surviveWin) Met(g *Game, p *Player) bool {
+	return p.Alive
+}
+
+// Gets every team that a registered role plays for, in the order of the roles
+func Teams() []*Team {
+	teams := make([]*Team, 0)
+	seen := make(map[*Team]bool)
+	for _, role := range Roles() {
+		if !seen[role.Team()] {
+			seen[role.Team()] = true
+			teams = append(teams, role.Team())
+		}
+	}
+	return teams
+}
+
+// works out whether the game is over from every player's win condition
+// nil while the game goes on
+// it ends in a draw once nobody alive can end it, or when more than one team ends it at once
+func (g *Game) decideResult() *GameResult {
+	ended := make([]*Team, 0)
+	canEnd := false
+	for _, p := range g.Players {
+		role := p.Role()
+		if role == nil || !role.WinCondition().EndsGame() {
+			continue
+		}
+		if p.Alive {
+			canEnd = true
+		}
+		if !containsTeam(ended, role.Team()) && role.WinCondition().Met(g, p) {
+			ended = append(ended, role.Team())
+		}
+	}
+
+	if len(ended) == 0 && canEnd {
+		return nil
+	}
+
+	result := newResult(DrawStage)
+	result.Draw = true
+	if len(ended) == 1 {
+		result = newResult(ended[0].VictoryStage)
+		result.Winner = ended[0].Name
+	}
+
+	if result.Draw {
+		for _, team := range ended {
+			result.EndedBy = append(result.EndedBy, team.Name)
+		}
+	}
+
+	// the team that ended the game wins whether its players are alive or not
+	// in a draw the teams that ended it do not win, only those with their own conditions can
+	for _, p := range g.Players {
+		role := p.Role()
+		if role == nil {
+			continue
+		}
+		if role.WinCondition().EndsGame() {
+			if !result.Draw && containsTeam(ended, role.Team()) {
+				result.addWinner(p)
+			}
+		} else if role.WinCondition().Met(g, p) {
+			result.addWinner(p)
+		}
+	}
+	return &result
+}
+
+// the result of the moderator ending the game, with every player on team winning
+// team is nil when nobody wins
+func (g *Game) declareResult(stage int, team *Team) *GameResult {
+	result := newResult(stage)
+	if team == nil {
+		return &result
+	}
+	result.Winner = team.Name
+	for _, p := range g.Players {
+		if role := p.Role(); role != nil && role.Team() == team {
+			result.addWinner(p)
+		}
+	}
+	return &result
+}
+
+func newResult(stage int) GameResult {
+	return GameResult{Stage: stage, PlayerIDs: make([]uint, 0), Teams: make([]string, 0)}
+}
+
+func (r *GameResult) addWinner(p *Player) {
+	r.PlayerIDs = append(r.PlayerIDs, p.PlayerID)
+	sort.Slice(r.PlayerIDs, func(i, j int) bool { return r.PlayerIDs[i] < r.PlayerIDs[j] })
+
+	team := p.Role().Team().Name
+	for _, name := range r.Teams {
+		if name == team {
+			return
+		}
+	}
+	r.Teams = append(r.Teams, team)
+}
+
+// Whether the player won the game
+func (r *GameResult) Won(playerID uint) bool {
+	for _, id := range r.PlayerIDs {
+		if id == playerID {
+			return true
+		}
+	}
+	return false
+}
+
+// writes the result for storing as json, empty for a game that is still going
+func encodeResult(r *GameResult) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	encoded, err := json.Marshal(r)
+	return string(encoded), err
+}
+
+// reads a result written by encodeResult
+func decodeResult(encoded string) (*GameResult, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var r GameResult
+	err := json.Unmarshal([]byte(encoded), &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func containsTeam(teams []*Team, team *Team) bool {
+	for _, t := range teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecideResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		players []*Player
+		want    *GameResult
+	}{
+		{"game goes on", []*Player{
+			{PlayerID: 1, role: VillagerRole, Alive: true},
+			{PlayerID: 2, role: MafiaRole, Alive: true},
+			{PlayerID: 3, role: VillagerRole, Alive: true},
+		}, nil},
+		{"town wins", []*Player{
+			{PlayerID: 1, role: VillagerRole, Alive: true},
+			{PlayerID: 2, role: MafiaRole},
+			{PlayerID: 3, role: VillagerRole},
+		}, &GameResult{Stage: 11, Winner: "Town", PlayerIDs: []uint{1, 3}, Teams: []string{"Town"}}},
+		{"draw with only a survivor alive", []*Player{
+			{PlayerID: 1, role: VillagerRole},
+			{PlayerID: 2, role: MafiaRole},
+			{PlayerID: 3, role: SurvivorRole, Alive: true},
+		}, &GameResult{Stage: DrawStage, Draw: true, PlayerIDs: []uint{3}, Teams: []string{"Neutral"}}},
+		{"draw with everyone dead", []*Player{
+			{PlayerID: 1, role: VillagerRole},
+			{PlayerID: 2, role: SerialKillerRole},
+		}, &GameResult{Stage: DrawStage, Draw: true, PlayerIDs: []uint{}, Teams: []string{}}},
+	}
+
+	for _, test := range tests {
+		g := Game{Players: test.players}
+		got := g.decideResult()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
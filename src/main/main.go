@@ -3,18 +3,139 @@ package main
 import (
 	"db"
 	"flag"
+	"fmt"
+	"game"
+	"log"
+	"os"
 	"server"
+	"strconv"
 )
 
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] [migrate up|down [steps]|status]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// runs the migrate subcommand
+func migrate(dialect string, args []string) {
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "up":
+		ran, err := db.MigrateUp(db.Db, dialect)
+		for _, m := range ran {
+			log.Printf("Applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ran) == 0 {
+			log.Println("Already up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Bad number of steps %s", args[1])
+			}
+		}
+		reverted, err := db.MigrateDown(db.Db, dialect, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := db.GetMigrationStatus(db.Db, dialect)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Printf("%04d_%s\tapplied %s\n", s.Version, s.Name, s.Time.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", s.Version, s.Name)
+			}
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
 func main() {
 	var port int
 	var disableAuth bool
+	var storeType string
+	var source string
+	var autoMigrate bool
+	var authSecret string
 
 	flag.IntVar(&port, "port", 8069, "Port the server listens to")
+	flag.StringVar(&storeType, "store", "mysql", "Storage backend: mysql, sqlite or memory")
+	flag.StringVar(&source, "dsn", "", "Data source name for the storage backend (defaults to the local mafia database)")
+	flag.BoolVar(&autoMigrate, "migrate", true, "Apply pending migrations when the server starts")
+	flag.BoolVar(&disableAuth, "disableAuth", false, "Accept requests without checking their HMAC or player secret")
+	flag.StringVar(&authSecret, "authSecret", "", "Secret that signs requests which do not act as a player (random if not given)")
+	flag.Usage = usage
 
 	flag.Parse()
 
-	db.Open()
-	defer db.Db.Close()
-	server.Run(port, disableAuth)
+	var dialect string
+	switch storeType {
+	case "mysql":
+		if source == "" {
+			source = "root:@tcp(127.0.0.1:3306)/mafia"
+		}
+		dialect = "mysql"
+		db.Open(dialect, source)
+		defer db.Db.Close()
+		game.SetStore(game.NewMySQLStore(db.Db))
+	case "sqlite":
+		if source == "" {
+			source = "mafia.db"
+		}
+		dialect = "sqlite3"
+		db.Open(dialect, source)
+		defer db.Db.Close()
+		game.SetStore(game.NewSQLiteStore(db.Db))
+	case "memory":
+		game.SetStore(game.NewMemoryStore())
+	default:
+		log.Fatalf("Unknown store %s", storeType)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if dialect == "" {
+			log.Fatalf("The %s store has no schema to migrate", storeType)
+		}
+		migrate(dialect, flag.Args()[1:])
+		return
+	} else if flag.NArg() > 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if autoMigrate && dialect != "" {
+		ran, err := db.MigrateUp(db.Db, dialect)
+		for _, m := range ran {
+			log.Printf("Applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err := game.StartScheduler()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.Run(port, disableAuth, authSecret)
 }
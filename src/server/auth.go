@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"game"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// how far Time-Sent can be from the time a request is received
+const timeWindow = 10 * time.Second
+
+// largest request body read, so that unsigned requests cannot make the server buffer any amount
+const maxBodySize = 64 << 10
+
+// secret that signs requests which do not act as a player
+var serverSecret string
+
+type contextKey int
+
+const authPlayerKey contextKey = 0
+
+// signatures that were already used, kept until they fall out of the time window
+type seenSignatures struct {
+	sync.Mutex
+	expiries map[string]time.Time
+}
+
+var seen = &seenSignatures{expiries: make(map[string]time.Time)}
+
+// records a signature and returns false if it was already used
+func (s *seenSignatures) add(signature string, now time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for sig, expiry := range s.expiries {
+		if now.After(expiry) {
+			delete(s.expiries, sig)
+		}
+	}
+
+	if _, ok := s.expiries[signature]; ok {
+		return false
+	}
+	s.expiries[signature] = now.Add(2 * timeWindow)
+	return true
+}
+
+// makes a random server secret for when none is given
+func generateServerSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// decodes the HMAC header with the format in the Encoding header
+func decodeHMAC(r *http.Request) ([]byte, error) {
+	mac := r.Header.Get("HMAC")
+	if mac == "" {
+		return nil, errors.New("HMAC header missing")
+	}
+
+	switch encoding := r.Header.Get("Encoding"); encoding {
+	case "", "hex":
+		return hex.DecodeString(mac)
+	case "base64":
+		return base64.StdEncoding.DecodeString(mac)
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown encoding %s", encoding))
+	}
+}
+
+// parses the Time-Sent header and checks it is within the time window
+func checkTimeSent(r *http.Request, now time.Time) (string, error) {
+	timeSent := r.Header.Get("Time-Sent")
+	seconds, err := strconv.ParseInt(timeSent, 10, 64)
+	if err != nil {
+		return "", errors.New("Error parsing Time-Sent header")
+	}
+
+	diff := now.Sub(time.Unix(seconds, 0))
+	if diff > timeWindow || diff < -timeWindow {
+		return "", errors.New("Time-Sent is not within 10 seconds of the server time")
+	}
+	return timeSent, nil
+}
+
+// reads the body so that it can be signed, then puts it back for the handler
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// gets the secret the request must be signed with
+// requests that act as a player are signed with that player's secret
+// returns the player, or nil for the server secret
+func signingKey(r *http.Request) (*game.Player, string, error) {
+	if r.URL.Query().Get("PlayerID") == "" {
+		return nil, serverSecret, nil
+	}
+
+	gameID, err := stringtoUint(mux.Vars(r)["GameID"])
+	if err != nil {
+		return nil, "", errors.New("Error parsing Game ID")
+	}
+
+	playerID, err := stringtoUint(r.URL.Query().Get("PlayerID"))
+	if err != nil {
+		return nil, "", errors.New("Error parsing PlayerID (Query)")
+	}
+
+	g, err := game.GetGame(gameID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	p, err := g.FindPlayerWithID(playerID)
+	if err != nil {
+		return nil, "", err
+	}
+	if p.Secret() == "" {
+		return nil, "", game.ErrBadSecret
+	}
+	return p, p.Secret(), nil
+}
+
+// checks the request's HMAC
+// the message is (Time-Sent):(path and query):(body)
+func verifyRequest(r *http.Request) (*game.Player, error) {
+	now := time.Now()
+
+	mac, err := decodeHMAC(r)
+	if err != nil {
+		return nil, err
+	}
+
+	timeSent, err := checkTimeSent(r, now)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p, secret, err := signingKey(r)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "%s:%s:", timeSent, r.URL.RequestURI())
+	h.Write(body)
+	if !hmac.Equal(mac, h.Sum(nil)) {
+		return nil, errors.New("HMAC does not match request")
+	}
+
+	if !seen.add(hex.EncodeToString(mac), now) {
+		return nil, errors.New("HMAC has already been used")
+	}
+
+	return p, nil
+}
+
+// Auth only lets signed requests through to the handler
+// bodies are capped at maxBodySize whether or not auth is enabled
+// does nothing when auth is disabled
+func Auth(handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+		if !requireAuth {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := verifyRequest(r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, errors.New(fmt.Sprintf("Request body is larger than %d bytes", maxBodySize)), 413)
+			return
+		}
+		if err != nil {
+			WriteError(w, err, 401)
+			return
+		}
+
+		if p != nil {
+			r = r.WithContext(context.WithValue(r.Context(), authPlayerKey, p.PlayerID))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// gets the player a signed request acted as
+func signedPlayer(r *http.Request) (uint, bool) {
+	playerID, ok := r.Context().Value(authPlayerKey).(uint)
+	return playerID, ok
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"game"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// loads the game and works out who is chatting from the request
+// writes the error and returns nil if they cannot be authenticated
+func chatGame(w http.ResponseWriter, r *http.Request) (*game.Game, game.Viewer) {
+	vars := mux.Vars(r)
+	gameID, err := stringtoUint(vars["GameID"])
+	if err != nil {
+		WriteErrorString(w, "Error parsing Game ID", 400)
+		return nil, game.Viewer{}
+	}
+
+	g, err := game.GetGame(gameID)
+	if err != nil {
+		WriteError(w, err, 500)
+		return nil, game.Viewer{}
+	}
+
+	viewer, err := getViewer(g, r)
+	if err != nil {
+		WriteError(w, err, 401)
+		return nil, game.Viewer{}
+	}
+
+	return g, viewer
+}
+
+func getChat(w http.ResponseWriter, r *http.Request) {
+	g, viewer := chatGame(w, r)
+	if g == nil {
+		return
+	}
+
+	var before uint
+	var err error
+	if r.FormValue("Before") != "" {
+		before, err = stringtoUint(r.FormValue("Before"))
+		if err != nil {
+			WriteErrorString(w, "Error parsing Before (Query)", 400)
+			return
+		}
+	}
+
+	limit := game.MaxChatPage
+	if r.FormValue("Limit") != "" {
+		limit, err = strconv.Atoi(r.FormValue("Limit"))
+		if err != nil {
+			WriteErrorString(w, "Error parsing Limit (Query)", 400)
+			return
+		}
+	}
+
+	messages, err := g.GetChat(viewer, r.FormValue("Channel"), before, limit)
+	if err != nil {
+		WriteError(w, err, 403)
+		return
+	}
+
+	WriteJson(w, genMap("Messages", messages))
+}
+
+func postChat(w http.ResponseWriter, r *http.Request) {
+	var parsedJson map[string]string
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&parsedJson)
+	if err != nil {
+		WriteErrorString(w, err.Error()+" in parsing POST body (JSON)", 400)
+		return
+	}
+
+	g, viewer := chatGame(w, r)
+	if g == nil {
+		return
+	}
+
+	message, err := g.PostChat(viewer, r.FormValue("Channel"), parsedJson["Text"])
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	WriteJson(w, message)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"game"
+	"strings"
+	"ws"
+)
+
+// data for each websocket command
+type joinCommand struct {
+	JoinCode string
+	Name     string
+}
+
+type moveCommand struct {
+	TargetID uint
+	MoveType uint
+}
+
+type chatCommand struct {
+	Channel string
+	Text    string
+}
+
+type readyCommand struct {
+	Ready bool
+}
+
+type textCommand struct {
+	Text string
+}
+
+// parses a command's data, which has to be there
+func parseCommandData(c ws.Command, data interface{}) error {
+	if len(c.Data) == 0 {
+		return errors.New(fmt.Sprintf("%s command has no data", c.Type))
+	}
+	err := json.Unmarshal(c.Data, data)
+	if err != nil {
+		return errors.New(err.Error() + " in parsing command data (JSON)")
+	}
+	return nil
+}
+
+// runs a command sent over a game's websocket
+// connections were authenticated when they opened, so commands act as the connection's player
+func handleCommand(s ws.Session, c ws.Command) (interface{}, uint, error) {
+	g, err := game.GetGame(s.GameID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch c.Type {
+	case "join":
+		var data joinCommand
+		err = parseCommandData(c, &data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s.PlayerID != 0 || s.Moderator {
+			return nil, 0, errors.New("Connection already belongs to a player")
+		}
+		if !g.IsLobby() || g.JoinCode != strings.ToUpper(data.JoinCode) {
+			return nil, 0, errors.New("No open lobby with that join code")
+		}
+		session, err := g.JoinLobby(data.Name)
+		if err != nil {
+			return nil, 0, err
+		}
+		// the connection is the new player's from now on
+		return session, session.PlayerID, nil
+
+	case "move":
+		var data moveCommand
+		err = parseCommandData(c, &data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s.PlayerID == 0 {
+			return nil, 0, errors.New("Only players can move")
+		}
+		retMap, err := g.MakeGameMove(s.PlayerID, data.TargetID, data.MoveType)
+		if err != nil {
+			return nil, 0, err
+		}
+		return genMap("Result", retMap), 0, nil
+
+	case "chat":
+		var data chatCommand
+		err = parseCommandData(c, &data)
+		if err != nil {
+			return nil, 0, err
+		}
+		message, err := g.PostChat(game.Viewer{PlayerID: s.PlayerID, Moderator: s.Moderator}, data.Channel, data.Text)
+		if err != nil {
+			return nil, 0, err
+		}
+		return message, 0, nil
+
+	case "ready":
+		var data readyCommand
+		err = parseCommandData(c, &data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s.PlayerID == 0 {
+			return nil, 0, errors.New("Only players can get ready")
+		}
+		err = g.SetReady(s.PlayerID, data.Ready)
+		if err != nil {
+			return nil, 0, err
+		}
+		return genMap("Ready", data.Ready), 0, nil
+
+	case "will", "lastWords":
+		var data textCommand
+		err = parseCommandData(c, &data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s.PlayerID == 0 {
+			return nil, 0, errors.New("Only players can write a will or last words")
+		}
+		if c.Type == "will" {
+			err = g.SetWill(s.PlayerID, data.Text)
+		} else {
+			err = g.SetLastWords(s.PlayerID, data.Text)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return genMap("Text", data.Text), 0, nil
+	}
+
+	return nil, 0, errors.New(fmt.Sprintf("Unknown command %s", c.Type))
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/gorilla/mux"
 	// "log"
 	"net/http"
-	// "ws"
+	"ws"
 )
 
 func sexgod(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +23,12 @@ func getGames(w http.ResponseWriter, r *http.Request) {
 	WriteJson(w, genMap("Games", games))
 }
 
+// counts the games with a websocket hub and the connections across them
+func getStats(w http.ResponseWriter, r *http.Request) {
+	hubCount, connectionCount := ws.Stats()
+	WriteJson(w, map[string]interface{}{"Hubs": hubCount, "Connections": connectionCount})
+}
+
 func makeGame(w http.ResponseWriter, r *http.Request) {
 	var parsedJson map[string]uint
 	decoder := json.NewDecoder(r.Body)
@@ -39,32 +45,12 @@ func makeGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mafiaCount, ok := parsedJson["MafiaCount"]
-	if !ok {
-		WriteErrorString(w, "MafiaCount (uint) not in POST body (JSON)", 400)
+	options, err := parseOptions(parsedJson)
+	if err != nil {
+		WriteError(w, err, 400)
 		return
 	}
-
-	doctorCount, ok := parsedJson["DoctorCount"]
-	if !ok {
-		// WriteErrorString(w, "DoctorCount (uint) not in POST body (JSON)", 400)
-		// return
-		doctorCount = 0
-	}
-
-	sherriffCount, ok := parsedJson["SherriffCount"]
-	if !ok {
-		// WriteErrorString(w, "SherriffCount (uint) not in POST body (JSON)", 400)
-		// return
-		sherriffCount = 0
-	}
-
-	options := game.GameOptions{
-		PlayerCount:   playerCount,
-		MafiaCount:    mafiaCount,
-		DoctorCount:   doctorCount,
-		SherriffCount: sherriffCount,
-	}
+	options.PlayerCount = playerCount
 
 	err = options.Verify()
 	if err != nil {
@@ -78,7 +64,8 @@ func makeGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	WriteJson(w, genMap("GameID", newGame.GameID))
+	// the moderator secret is only given out when the game is made
+	WriteJson(w, map[string]interface{}{"GameID": newGame.GameID, "ModeratorSecret": newGame.ModeratorSecret()})
 }
 
 func getGameInfo(w http.ResponseWriter, r *http.Request) {
@@ -89,13 +76,22 @@ func getGameInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// read before loading the game so no event after it can be missed
+	seq := ws.LastSeq(gameID)
+
 	g, err := game.GetGame(gameID)
 	if err != nil {
 		WriteError(w, err, 500)
 		return
 	}
 
-	WriteJson(w, genMap("Info", *g))
+	viewer, err := getViewer(g, r)
+	if err != nil {
+		WriteError(w, err, 401)
+		return
+	}
+
+	WriteJson(w, map[string]interface{}{"Info": g.View(viewer), "Seq": seq})
 }
 
 func getPlayerInfo(w http.ResponseWriter, r *http.Request) {
@@ -138,13 +134,45 @@ func registerPlayer(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	roles := g.NamesToPlayerIDRoles(parsedJson["PlayerNames"])
+	// roles are only given out through getRoles with the player's secret
+	sessions := g.NamesToPlayerSessions(parsedJson["PlayerNames"])
 
-	WriteJson(w, roles)
+	WriteJson(w, sessions)
 }
 
 func getRoles(w http.ResponseWriter, r *http.Request) {
-	WriteJson(w, genMap("Role", "Mafia"))
+	vars := mux.Vars(r)
+	gameID, err := stringtoUint(vars["GameID"])
+	if err != nil {
+		WriteErrorString(w, "Error parsing Game ID", 400)
+		return
+	}
+
+	playerID, err := stringtoUint(vars["UserID"])
+	if err != nil {
+		WriteErrorString(w, "Error parsing Player ID", 400)
+		return
+	}
+
+	g, err := game.GetGame(gameID)
+	if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	err = authenticatePlayer(g, playerID, r)
+	if err != nil {
+		WriteError(w, err, 401)
+		return
+	}
+
+	info, err := g.GetRoleInfo(playerID)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	WriteJson(w, info)
 }
 
 func makeMove(w http.ResponseWriter, r *http.Request) {
@@ -179,6 +207,12 @@ func makeMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = authenticatePlayer(g, playerID, r)
+	if err != nil {
+		WriteError(w, err, 401)
+		return
+	}
+
 	retMap, err := g.MakeGameMove(playerID, targetID, role)
 	if err != nil {
 		WriteError(w, err, 500)
@@ -195,25 +229,29 @@ func makeMove(w http.ResponseWriter, r *http.Request) {
 	// }
 }
 
-func progressStage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	gameID, err := stringtoUint(vars["GameID"])
-	if err != nil {
-		WriteErrorString(w, "Error parsing Game ID", 400)
-		return
-	}
+// only lets a websocket get a player's private events with that player's secret
+// and the moderator's view with the moderator secret
+func serveWs(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("PlayerID") != "" || r.FormValue("Moderator") == "true" {
+		vars := mux.Vars(r)
+		gameID, err := stringtoUint(vars["GameID"])
+		if err != nil {
+			WriteErrorString(w, "Error parsing Game ID", 400)
+			return
+		}
 
-	g, err := game.GetGame(gameID)
-	if err != nil {
-		WriteError(w, err, 500)
-		return
-	}
+		g, err := game.GetGame(gameID)
+		if err != nil {
+			WriteError(w, err, 500)
+			return
+		}
 
-	err = g.ProgressStage()
-	if err != nil {
-		WriteError(w, err, 500)
-		return
+		_, err = getViewer(g, r)
+		if err != nil {
+			WriteError(w, err, 401)
+			return
+		}
 	}
 
-	w.WriteHeader(200)
+	ws.ServeWs(w, r)
 }
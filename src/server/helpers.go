@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"game"
 	"log"
 	"net/http"
 	"strconv"
@@ -14,6 +15,219 @@ func stringtoUint(s string) (uint, error) {
 	return uint(i), err
 }
 
+// gets the player's secret from the Secret header, or the query for websockets
+func getSecret(r *http.Request) string {
+	if secret := r.Header.Get("Secret"); secret != "" {
+		return secret
+	}
+	return r.FormValue("Secret")
+}
+
+// checks the request was signed by the player or has their secret
+// always passes when auth is disabled
+func authenticatePlayer(g *game.Game, playerID uint, r *http.Request) error {
+	signedID, signed := signedPlayer(r)
+	if !requireAuth || (signed && signedID == playerID) {
+		_, err := g.FindPlayerWithID(playerID)
+		return err
+	}
+	_, err := g.AuthenticatePlayer(playerID, getSecret(r))
+	return err
+}
+
+// works out who is looking at a game from the request's query and secret
+// PlayerID (Query) views as that player, Moderator=true (Query) as the moderator
+// and anyone else is a spectator
+func getViewer(g *game.Game, r *http.Request) (game.Viewer, error) {
+	if r.FormValue("Moderator") == "true" {
+		if requireAuth {
+			err := g.CheckModeratorSecret(getSecret(r))
+			if err != nil {
+				return game.Viewer{}, err
+			}
+		}
+		return game.Viewer{Moderator: true}, nil
+	}
+
+	if r.FormValue("PlayerID") != "" {
+		playerID, err := stringtoUint(r.FormValue("PlayerID"))
+		if err != nil {
+			return game.Viewer{}, errors.New("Error parsing PlayerID (Query)")
+		}
+		err = authenticatePlayer(g, playerID, r)
+		if err != nil {
+			return game.Viewer{}, err
+		}
+		return game.Viewer{PlayerID: playerID}, nil
+	}
+
+	return game.Viewer{}, nil
+}
+
+// reads the options for a new game out of a POST body, other than PlayerCount
+func parseOptions(parsedJson map[string]uint) (game.GameOptions, error) {
+	mafiaCount, ok := parsedJson["MafiaCount"]
+	if !ok {
+		return game.GameOptions{}, errors.New("MafiaCount (uint) not in POST body (JSON)")
+	}
+
+	doctorCount, ok := parsedJson["DoctorCount"]
+	if !ok {
+		doctorCount = 0
+	}
+
+	sherriffCount, ok := parsedJson["SherriffCount"]
+	if !ok {
+		sherriffCount = 0
+	}
+
+	// 0 intervals means the stage only ends when everyone has moved
+	dayTimeIntervals, ok := parsedJson["DayTimeIntervals"]
+	if !ok {
+		dayTimeIntervals = 0
+	}
+
+	nightTimeIntervals, ok := parsedJson["NightTimeIntervals"]
+	if !ok {
+		nightTimeIntervals = 0
+	}
+
+	// plurality voting unless another system is picked
+	votingSystem, ok := parsedJson["VotingSystem"]
+	if !ok {
+		votingSystem = game.PluralityVoting
+	}
+
+	// days are a single vote unless trials are turned on
+	trials, ok := parsedJson["Trials"]
+	if !ok {
+		trials = 0
+	}
+
+	nominationSeconds, ok := parsedJson["NominationSeconds"]
+	if !ok {
+		nominationSeconds = 0
+	}
+
+	defenseIntervals, ok := parsedJson["DefenseIntervals"]
+	if !ok {
+		defenseIntervals = 0
+	}
+
+	judgmentIntervals, ok := parsedJson["JudgmentIntervals"]
+	if !ok {
+		judgmentIntervals = 0
+	}
+
+	// lynched players get no last words unless they are given time for them
+	lastWordsIntervals, ok := parsedJson["LastWordsIntervals"]
+	if !ok {
+		lastWordsIntervals = 0
+	}
+
+	// nothing about the dead is revealed unless asked for
+	deathReveal, ok := parsedJson["DeathReveal"]
+	if !ok {
+		deathReveal = game.NoReveal
+	}
+
+	// the mafia only win once nobody else is left, unless they win at parity
+	mafiaParity, ok := parsedJson["MafiaParity"]
+	if !ok {
+		mafiaParity = 0
+	}
+
+	jesterCount, ok := parsedJson["JesterCount"]
+	if !ok {
+		jesterCount = 0
+	}
+
+	serialKillerCount, ok := parsedJson["SerialKillerCount"]
+	if !ok {
+		serialKillerCount = 0
+	}
+
+	survivorCount, ok := parsedJson["SurvivorCount"]
+	if !ok {
+		survivorCount = 0
+	}
+
+	vigilanteCount, ok := parsedJson["VigilanteCount"]
+	if !ok {
+		vigilanteCount = 0
+	}
+
+	bodyguardCount, ok := parsedJson["BodyguardCount"]
+	if !ok {
+		bodyguardCount = 0
+	}
+
+	roleblockerCount, ok := parsedJson["RoleblockerCount"]
+	if !ok {
+		roleblockerCount = 0
+	}
+
+	trackerCount, ok := parsedJson["TrackerCount"]
+	if !ok {
+		trackerCount = 0
+	}
+
+	lookoutCount, ok := parsedJson["LookoutCount"]
+	if !ok {
+		lookoutCount = 0
+	}
+
+	godfatherCount, ok := parsedJson["GodfatherCount"]
+	if !ok {
+		godfatherCount = 0
+	}
+
+	framerCount, ok := parsedJson["FramerCount"]
+	if !ok {
+		framerCount = 0
+	}
+
+	janitorCount, ok := parsedJson["JanitorCount"]
+	if !ok {
+		janitorCount = 0
+	}
+
+	consortCount, ok := parsedJson["ConsortCount"]
+	if !ok {
+		consortCount = 0
+	}
+
+	options := game.GameOptions{
+		MafiaCount:         mafiaCount,
+		DoctorCount:        doctorCount,
+		SherriffCount:      sherriffCount,
+		DayTimeIntervals:   dayTimeIntervals,
+		NightTimeIntervals: nightTimeIntervals,
+		VotingSystem:       votingSystem,
+		Trials:             trials,
+		NominationSeconds:  nominationSeconds,
+		DefenseIntervals:   defenseIntervals,
+		JudgmentIntervals:  judgmentIntervals,
+		LastWordsIntervals: lastWordsIntervals,
+		DeathReveal:        deathReveal,
+		MafiaParity:        mafiaParity,
+		JesterCount:        jesterCount,
+		SerialKillerCount:  serialKillerCount,
+		SurvivorCount:      survivorCount,
+		VigilanteCount:     vigilanteCount,
+		BodyguardCount:     bodyguardCount,
+		RoleblockerCount:   roleblockerCount,
+		TrackerCount:       trackerCount,
+		LookoutCount:       lookoutCount,
+		GodfatherCount:     godfatherCount,
+		FramerCount:        framerCount,
+		JanitorCount:       janitorCount,
+		ConsortCount:       consortCount,
+	}
+
+	return options, nil
+}
+
 func WriteError(w http.ResponseWriter, err error, errorCode int) {
 	log.Println(err)
 	errorMap := make(map[string]string)
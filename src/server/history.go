@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"game"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+var errHistoryClosed = errors.New("History is only open to the moderator until the game is over")
+var errReplayClosed = errors.New("Replay is only open to the moderator until a team wins or the game is drawn")
+
+// loads the game and checks the request can see its history
+// writes the error and returns nil if it cannot
+func historyGame(w http.ResponseWriter, r *http.Request) *game.Game {
+	vars := mux.Vars(r)
+	gameID, err := stringtoUint(vars["GameID"])
+	if err != nil {
+		WriteErrorString(w, "Error parsing Game ID", 400)
+		return nil
+	}
+
+	g, err := game.GetGame(gameID)
+	if err != nil {
+		WriteError(w, err, 500)
+		return nil
+	}
+
+	viewer, err := getViewer(g, r)
+	if err != nil {
+		WriteError(w, err, 401)
+		return nil
+	}
+
+	// the history has every role and night move in it
+	if requireAuth && !viewer.Moderator && !g.IsOver() {
+		WriteError(w, errHistoryClosed, 403)
+		return nil
+	}
+
+	return g
+}
+
+func getHistory(w http.ResponseWriter, r *http.Request) {
+	g := historyGame(w, r)
+	if g == nil {
+		return
+	}
+
+	events, err := g.History()
+	if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	WriteJson(w, genMap("Events", events))
+}
+
+// rebuilds the game from its history, up to Seq (Query) if it is given
+func getHistoryState(w http.ResponseWriter, r *http.Request) {
+	g := historyGame(w, r)
+	if g == nil {
+		return
+	}
+
+	var seq uint
+	var err error
+	if r.FormValue("Seq") != "" {
+		seq, err = stringtoUint(r.FormValue("Seq"))
+		if err != nil {
+			WriteErrorString(w, "Error parsing Seq (Query)", 400)
+			return
+		}
+	}
+
+	rebuilt, err := g.Rebuild(seq)
+	if err == game.ErrNoHistory {
+		WriteError(w, err, 404)
+		return
+	} else if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	WriteJson(w, genMap("Info", rebuilt.View(game.Viewer{Moderator: true})))
+}
+
+// gives the replay of a game a team has won, as json (default), text or markdown
+func getReplay(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID, err := stringtoUint(vars["GameID"])
+	if err != nil {
+		WriteErrorString(w, "Error parsing Game ID", 400)
+		return
+	}
+
+	g, err := game.GetGame(gameID)
+	if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	viewer, err := getViewer(g, r)
+	if err != nil {
+		WriteError(w, err, 401)
+		return
+	}
+
+	if requireAuth && !viewer.Moderator && g.Winner() == nil && g.Stage != game.DrawStage {
+		WriteError(w, errReplayClosed, 403)
+		return
+	}
+
+	format := r.FormValue("Format")
+	if format == "" {
+		format = r.FormValue("format")
+	}
+	if format != "" && format != "json" && format != "text" && format != "markdown" {
+		WriteErrorString(w, "Format (Query) has to be json, text or markdown", 400)
+		return
+	}
+
+	replay, err := g.Replay()
+	if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(replay.Text()))
+	case "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(replay.Markdown()))
+	default:
+		WriteJson(w, genMap("Replay", replay))
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"game"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// loads the game and checks the request has the PlayerID (Query) player's secret
+// writes the error and returns nil if it does not
+func playerGame(w http.ResponseWriter, r *http.Request) (*game.Game, uint) {
+	vars := mux.Vars(r)
+	gameID, err := stringtoUint(vars["GameID"])
+	if err != nil {
+		WriteErrorString(w, "Error parsing Game ID", 400)
+		return nil, 0
+	}
+
+	playerID, err := stringtoUint(r.FormValue("PlayerID"))
+	if err != nil {
+		WriteErrorString(w, "Error parsing PlayerID (Query)", 400)
+		return nil, 0
+	}
+
+	g, err := game.GetGame(gameID)
+	if err != nil {
+		WriteError(w, err, 500)
+		return nil, 0
+	}
+
+	err = authenticatePlayer(g, playerID, r)
+	if err != nil {
+		WriteError(w, err, 401)
+		return nil, 0
+	}
+
+	return g, playerID
+}
+
+func makeLobby(w http.ResponseWriter, r *http.Request) {
+	g, err := game.MakeLobby()
+	if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	// the host runs the game, so they get the moderator secret
+	WriteJson(w, map[string]interface{}{"GameID": g.GameID, "JoinCode": g.JoinCode, "ModeratorSecret": g.ModeratorSecret()})
+}
+
+func getLobby(w http.ResponseWriter, r *http.Request) {
+	g, err := game.GetLobbyGame(mux.Vars(r)["JoinCode"])
+	if err == game.ErrGameNotFound {
+		WriteErrorString(w, "No open lobby with that join code", 404)
+		return
+	} else if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	WriteJson(w, genMap("GameID", g.GameID))
+}
+
+func joinLobby(w http.ResponseWriter, r *http.Request) {
+	var parsedJson map[string]string
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&parsedJson)
+	if err != nil {
+		WriteErrorString(w, err.Error()+" in parsing POST body (JSON)", 400)
+		return
+	}
+
+	g, err := game.GetLobbyGame(mux.Vars(r)["JoinCode"])
+	if err == game.ErrGameNotFound {
+		WriteErrorString(w, "No open lobby with that join code", 404)
+		return
+	} else if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	session, err := g.JoinLobby(parsedJson["Name"])
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	WriteJson(w, map[string]interface{}{"GameID": g.GameID, "PlayerID": session.PlayerID, "Secret": session.Secret})
+}
+
+func leaveLobby(w http.ResponseWriter, r *http.Request) {
+	g, playerID := playerGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.LeaveLobby(playerID)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func renamePlayer(w http.ResponseWriter, r *http.Request) {
+	g, playerID := playerGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.RenamePlayer(playerID, r.FormValue("Name"))
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func setReady(w http.ResponseWriter, r *http.Request) {
+	g, playerID := playerGame(w, r)
+	if g == nil {
+		return
+	}
+
+	ready, err := strconv.ParseBool(r.FormValue("Ready"))
+	if err != nil {
+		WriteErrorString(w, "Error parsing Ready (Query)", 400)
+		return
+	}
+
+	err = g.SetReady(playerID, ready)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func startLobby(w http.ResponseWriter, r *http.Request) {
+	var parsedJson map[string]uint
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&parsedJson)
+	if err != nil {
+		WriteErrorString(w, err.Error()+" in parsing POST body (JSON)", 400)
+		return
+	}
+
+	options, err := parseOptions(parsedJson)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err = g.StartLobby(options)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"game"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// loads the game and checks the request has its moderator secret
+// writes the error and returns nil if it does not
+func moderatedGame(w http.ResponseWriter, r *http.Request) *game.Game {
+	vars := mux.Vars(r)
+	gameID, err := stringtoUint(vars["GameID"])
+	if err != nil {
+		WriteErrorString(w, "Error parsing Game ID", 400)
+		return nil
+	}
+
+	g, err := game.GetGame(gameID)
+	if err != nil {
+		WriteError(w, err, 500)
+		return nil
+	}
+
+	if requireAuth {
+		err = g.CheckModeratorSecret(getSecret(r))
+		if err != nil {
+			WriteError(w, err, 403)
+			return nil
+		}
+	}
+
+	return g
+}
+
+// gets the player the moderator is acting on
+// TargetID is used since a PlayerID query means the request is signed by that player
+func moderatorTarget(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	targetID, err := stringtoUint(r.FormValue("TargetID"))
+	if err != nil {
+		WriteErrorString(w, "Error parsing TargetID (Query)", 400)
+		return 0, false
+	}
+	return targetID, true
+}
+
+func pauseGame(w http.ResponseWriter, r *http.Request) {
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.Pause()
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func resumeGame(w http.ResponseWriter, r *http.Request) {
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.Resume()
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func progressStage(w http.ResponseWriter, r *http.Request) {
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.ForceAdvance()
+	if err != nil {
+		WriteError(w, err, 500)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func killPlayer(w http.ResponseWriter, r *http.Request) {
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	targetID, ok := moderatorTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := g.KillPlayer(targetID)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func revivePlayer(w http.ResponseWriter, r *http.Request) {
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	targetID, ok := moderatorTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := g.RevivePlayer(targetID)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func swapPlayer(w http.ResponseWriter, r *http.Request) {
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	targetID, ok := moderatorTarget(w, r)
+	if !ok {
+		return
+	}
+
+	session, err := g.SwapPlayer(targetID, r.FormValue("Name"))
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	// the new player's device needs the new secret
+	WriteJson(w, session)
+}
+
+func endGame(w http.ResponseWriter, r *http.Request) {
+	g := moderatedGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.EndGame(r.FormValue("Winner"))
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
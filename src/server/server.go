@@ -19,12 +19,23 @@ func Log(handler http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
-func Run(port int, disableAuth bool) {
+func Run(port int, disableAuth bool, authSecret string) {
 	//start := time.Now()
 
 	rand.Seed(time.Now().UTC().UnixNano())
 	r := mux.NewRouter()
 	requireAuth = !disableAuth
+	ws.HandleCommands(handleCommand)
+
+	serverSecret = authSecret
+	if requireAuth && serverSecret == "" {
+		var err error
+		serverSecret, err = generateServerSecret()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("No -authSecret given, signing requests with %s\n", serverSecret)
+	}
 
 	// user requests
 	// r.HandleFunc("/login", Log(login)).Methods("POST")
@@ -38,14 +49,46 @@ func Run(port int, disableAuth bool) {
 	//	r.HandleFunc("/games/{ID}/board", getBoard).Methods("GET")
 	//	r.HandleFunc("/games/{ID}/string", getGameString).Methods("GET")
 	//	r.HandleFunc("/hello_world", sexgod).Methods("GET")
+	r.HandleFunc("/stats", Log(getStats)).Methods("GET")
 	r.HandleFunc("/games", Log(getGames)).Methods("GET")
-	r.HandleFunc("/games", Log(makeGame)).Methods("POST")
+	r.HandleFunc("/games", Log(Auth(makeGame))).Methods("POST")
 	r.HandleFunc("/games/{GameID:[0-9]+}/info", Log(getGameInfo)).Methods("GET")
 	r.HandleFunc("/games/{GameID:[0-9]+}/roles/{UserID:[0-9]+}", Log(getRoles)).Methods("GET")
-	r.HandleFunc("/games/{GameID:[0-9]+}/ws", Log(ws.ServeWs)).Methods("GET")
-	r.HandleFunc("/games/{GameID:[0-9]+}/move", Log(makeMove)).Methods("POST") // only for backwards compatibility
-	r.HandleFunc("/games/{GameID:[0-9]+}/deviceRegister", Log(registerPlayer)).Methods("POST")
-	r.HandleFunc("/games/{GameID:[0-9]+}/progressStage", Log(progressStage)).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/ws", Log(serveWs)).Methods("GET")
+	r.HandleFunc("/games/{GameID:[0-9]+}/move", Log(Auth(makeMove))).Methods("POST") // only for backwards compatibility
+	r.HandleFunc("/games/{GameID:[0-9]+}/deviceRegister", Log(Auth(registerPlayer))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/progressStage", Log(Auth(progressStage))).Methods("POST") // only for backwards compatibility
+
+	// chat requests
+	r.HandleFunc("/games/{GameID:[0-9]+}/chat", Log(getChat)).Methods("GET")
+	r.HandleFunc("/games/{GameID:[0-9]+}/chat", Log(Auth(postChat))).Methods("POST")
+
+	// will requests
+	r.HandleFunc("/games/{GameID:[0-9]+}/will", Log(Auth(setWill))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/lastWords", Log(Auth(setLastWords))).Methods("POST")
+
+	// history requests
+	r.HandleFunc("/games/{GameID:[0-9]+}/history", Log(getHistory)).Methods("GET")
+	r.HandleFunc("/games/{GameID:[0-9]+}/history/state", Log(getHistoryState)).Methods("GET")
+	r.HandleFunc("/games/{GameID:[0-9]+}/replay", Log(getReplay)).Methods("GET")
+
+	// lobby requests
+	r.HandleFunc("/lobbies", Log(Auth(makeLobby))).Methods("POST")
+	r.HandleFunc("/lobbies/{JoinCode:[0-9A-Za-z]+}", Log(getLobby)).Methods("GET")
+	r.HandleFunc("/lobbies/{JoinCode:[0-9A-Za-z]+}/join", Log(Auth(joinLobby))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/lobby/leave", Log(Auth(leaveLobby))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/lobby/name", Log(Auth(renamePlayer))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/lobby/ready", Log(Auth(setReady))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/lobby/start", Log(Auth(startLobby))).Methods("POST")
+
+	// moderator requests
+	r.HandleFunc("/games/{GameID:[0-9]+}/moderator/pause", Log(Auth(pauseGame))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/moderator/resume", Log(Auth(resumeGame))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/moderator/advance", Log(Auth(progressStage))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/moderator/kill", Log(Auth(killPlayer))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/moderator/revive", Log(Auth(revivePlayer))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/moderator/swap", Log(Auth(swapPlayer))).Methods("POST")
+	r.HandleFunc("/games/{GameID:[0-9]+}/moderator/end", Log(Auth(endGame))).Methods("POST")
 
 	//	r.HandleFunc("/games/{ID}/move", Log(makeGameMove)).Methods("POST")
 	//	r.HandleFunc("/users/{userID}/games", getUserGames).Methods("GET")
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// reads the Text out of a POST body
+func parseText(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var parsedJson map[string]string
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&parsedJson)
+	if err != nil {
+		WriteErrorString(w, err.Error()+" in parsing POST body (JSON)", 400)
+		return "", false
+	}
+	return parsedJson["Text"], true
+}
+
+func setWill(w http.ResponseWriter, r *http.Request) {
+	text, ok := parseText(w, r)
+	if !ok {
+		return
+	}
+
+	g, playerID := playerGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.SetWill(playerID, text)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func setLastWords(w http.ResponseWriter, r *http.Request) {
+	text, ok := parseText(w, r)
+	if !ok {
+		return
+	}
+
+	g, playerID := playerGame(w, r)
+	if g == nil {
+		return
+	}
+
+	err := g.SetLastWords(playerID, text)
+	if err != nil {
+		WriteError(w, err, 400)
+		return
+	}
+
+	w.WriteHeader(200)
+}
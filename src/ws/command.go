@@ -0,0 +1,114 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// version of the command protocol, sent with every reply
+const ProtocolVersion = 1
+
+// Command is a typed request a client sends over the websocket
+// {"v": 1, "id": "1", "type": "move", "data": {...}}
+type Command struct {
+	Version int             `json:"v"`
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Reply answers a command with an ack and its data, or an error
+// ID is the ID the command was sent with so the client can match them up
+type Reply struct {
+	Version int         `json:"v"`
+	ID      string      `json:"id"`
+	Type    string      `json:"type"` // "ack" or "error"
+	Command string      `json:"command"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// Session is who a connection acts as when it sends commands
+type Session struct {
+	GameID    uint
+	PlayerID  uint // 0 for spectators and the moderator
+	Moderator bool
+}
+
+// CommandHandler runs a command for a connection and gives back the data to ack it with
+// bind is a PlayerID to tie the connection to from then on, like after joining, or 0
+type CommandHandler func(s Session, c Command) (data interface{}, bind uint, err error)
+
+var commandHandler CommandHandler
+
+// Sets what runs the commands clients send
+// without a handler every command gets an error back
+func HandleCommands(handler CommandHandler) {
+	commandHandler = handler
+}
+
+// reply for a connection, which is bound to bind first if it is not 0
+type replyMessage struct {
+	c       *connection
+	message []byte
+	bind    uint
+}
+
+// runs one message from a client and gives back the reply
+func runCommand(s Session, message []byte) (Reply, uint) {
+	var c Command
+	err := json.Unmarshal(message, &c)
+	if err != nil {
+		return Reply{Version: ProtocolVersion, Type: "error", Error: "Error parsing command (JSON)"}, 0
+	}
+
+	reply := Reply{Version: ProtocolVersion, ID: c.ID, Command: c.Type}
+	if c.Version != ProtocolVersion {
+		err = errors.New(fmt.Sprintf("Unsupported protocol version %d, use %d", c.Version, ProtocolVersion))
+	} else if c.Type == "" {
+		err = errors.New("Command has no type")
+	} else if commandHandler == nil {
+		err = errors.New("Commands are not supported")
+	}
+
+	var bind uint
+	if err == nil {
+		reply.Data, bind, err = commandHandler(s, c)
+	}
+	if err != nil {
+		reply.Type = "error"
+		reply.Error = err.Error()
+		reply.Data = nil
+		return reply, 0
+	}
+
+	reply.Type = "ack"
+	return reply, bind
+}
+
+// reads commands off the connection until it closes
+func (c *connection) readCommands(s Session) {
+	for {
+		_, message, err := c.ws.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		reply, bind := runCommand(s, message)
+		if bind != 0 {
+			s.PlayerID = bind
+		}
+
+		jsonOut, err := json.Marshal(reply)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		select {
+		case c.h.replies <- replyMessage{c, jsonOut, bind}:
+		case <-c.h.done:
+		}
+	}
+}
@@ -24,7 +24,7 @@ const (
 	pingPeriod = (pongWait * 9) / 10
 
 	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	maxMessageSize = 4096
 )
 
 func sameOrigin(r *http.Request) bool { return true }
@@ -43,24 +43,30 @@ type connection struct {
 	// Buffered channel of outbound messages.
 	send chan []byte
 	h    *hub
+
+	// Player the connection belongs to, 0 for spectators.
+	playerID uint
+
+	// Whether the game's moderator is watching.
+	moderator bool
 }
 
-// readPump pumps messages from the websocket connection to the hub.
-func (c *connection) readPump() {
+// readPump reads commands from the websocket connection and replies through the hub.
+// s is who the commands read off the connection act as
+func (c *connection) readPump(s Session) {
 	defer func() {
-		c.h.unregister <- c
+		// the hub can only have been reaped if it already dropped the connection
+		select {
+		case c.h.unregister <- c:
+		case <-c.h.done:
+		}
 		c.ws.Close()
 	}()
 	c.ws.SetReadLimit(maxMessageSize)
 	c.ws.SetReadDeadline(time.Now().Add(pongWait))
 	c.ws.SetPongHandler(func(string) error { c.ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
-	for {
-		_, message, err := c.ws.ReadMessage()
-		if err != nil {
-			break
-		}
-		c.h.broadcast <- message
-	}
+	// messages from clients are commands, which get checked like API requests
+	c.readCommands(s)
 }
 
 // write writes a message with the given message type and payload.
@@ -96,6 +102,9 @@ func (c *connection) writePump() {
 }
 
 // serveWs handles websocket requests from the peer.
+// PlayerID (Query) ties the connection to a player so it gets their private events.
+// Moderator=true (Query) marks the connection as the moderator's.
+// Since (Query) replays the events after that sequence number before the live ones.
 func ServeWs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", 405)
@@ -111,21 +120,49 @@ func ServeWs(w http.ResponseWriter, r *http.Request) {
 	}
 	id := uint(i)
 
+	var playerID uint
+	if r.FormValue("PlayerID") != "" {
+		p, err := strconv.Atoi(r.FormValue("PlayerID"))
+		if err != nil || p < 0 {
+			http.Error(w, "Error parsing PlayerID (Query)", 400)
+			return
+		}
+		playerID = uint(p)
+	}
+
+	moderator := r.FormValue("Moderator") == "true"
+
+	var since uint64
+	sinceString := r.FormValue("Since")
+	if sinceString == "" {
+		sinceString = r.FormValue("since")
+	}
+	replay := sinceString != ""
+	if replay {
+		since, err = strconv.ParseUint(sinceString, 10, 64)
+		if err != nil {
+			http.Error(w, "Error parsing Since (Query)", 400)
+			return
+		}
+	}
+
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	if _, ok := hubMap[id]; !ok {
-		makeHub(id)
-	}
+	c := &connection{send: make(chan []byte, 1024), ws: ws, playerID: playerID, moderator: moderator}
 
-	h := hubMap[id]
-
-	c := &connection{send: make(chan []byte, 1024), ws: ws, h: h}
-
-	h.register <- c
+	// the hub may be reaped before it takes the connection, then the game gets a new one
+	for registered := false; !registered; {
+		c.h = hubs.get(id)
+		select {
+		case c.h.register <- registration{c, since, replay}:
+			registered = true
+		case <-c.h.done:
+		}
+	}
 	go c.writePump()
-	c.readPump()
+	c.readPump(Session{GameID: id, PlayerID: playerID, Moderator: moderator})
 }
@@ -8,91 +8,421 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"sync/atomic"
+	"time"
 )
 
+// most events a hub keeps to replay to connections that reconnect
+const maxEventLog = 1000
+
 // hub maintains the set of active connections and broadcasts messages to the
 // connections.
 type hub struct {
+	// Sequence number of the latest event, read atomically outside of run.
+	seq uint64
+
+	// Number of registered connections, read atomically outside of run.
+	connectionCount int64
+
+	// Whether the game is over, set atomically by FinishHub.
+	finished int32
+
 	// Registered connections.
 	connections map[*connection]bool
 
-	// Inbound messages from the connections.
+	// Messages sent to every connection without a sequence number, like ticks.
 	broadcast chan []byte
 
+	// Events to number, log and send.
+	events chan *hubEvent
+
+	// Replies to commands from a connection.
+	replies chan replyMessage
+
 	// Register requests from the connections.
-	register chan *connection
+	register chan registration
 
 	// Unregister requests from connections.
 	unregister chan *connection
+
+	// Players whose connections are closed, like after losing their seat.
+	drop chan uint
+
+	// Requests from the manager to stop if the hub is unused.
+	reap chan chan reapReply
+
+	// Closed once the hub has stopped, so nothing waits on it forever.
+	done chan struct{}
+
+	// Latest events, oldest first, so connections can catch up on what they missed.
+	log []*hubEvent
+
+	// Latest logged event of each type whose events replace the ones before them.
+	states map[string]*hubEvent
+
+	// When a connection or event last came through.
+	lastActive time.Time
+}
+
+// answer to a reap request
+type reapReply struct {
+	stopped  bool
+	seq      uint64
+	finished bool
 }
 
-var hubMap = make(map[uint]*hub)
+// ViewFunc builds the data of an event for one connection
+// playerID is 0 for spectators and the moderator
+// returning nil skips the connection
+type ViewFunc func(playerID uint, moderator bool) interface{}
+
+// who an event is built for, connections of the same viewer get the same message
+type viewer struct {
+	playerID  uint
+	moderator bool
+}
 
-func makeHub(i uint) *hub {
+// event that gets a sequence number and is kept in the hub's log
+type hubEvent struct {
+	seq       uint64
+	eventType string
+	playerID  uint                   // only that player's connections get it, 0 for everyone
+	data      interface{}            // the same for every connection
+	views     map[viewer]interface{} // the data for each viewer instead when set
+	replaces  bool                   // whether it replaces the logged events of its type before it
+	message   []byte                 // data encoded once the event has its sequence number
+	messages  map[viewer][]byte      // views encoded once the event has its sequence number
+}
+
+// connection to add to the hub
+// replay is whether it wants the events after since first
+type registration struct {
+	c      *connection
+	since  uint64
+	replay bool
+}
+
+// Resync is sent instead of replaying when the events a connection asked for are gone
+// the connection should fetch the game again, and events after Seq follow
+type Resync struct {
+	Seq uint64
+}
+
+var ErrNoHub = errors.New("No hub found with that ID")
+
+// makes a hub whose events are numbered after seq
+func makeHub(seq uint64) *hub {
 
 	h := hub{
+		seq:         seq,
 		broadcast:   make(chan []byte),
-		register:    make(chan *connection),
+		events:      make(chan *hubEvent),
+		replies:     make(chan replyMessage),
+		register:    make(chan registration),
 		unregister:  make(chan *connection),
+		drop:        make(chan uint),
+		reap:        make(chan chan reapReply),
+		done:        make(chan struct{}),
 		connections: make(map[*connection]bool),
+		states:      make(map[string]*hubEvent),
+		lastActive:  time.Now(),
 	}
 
 	//log.Println("made hub")
 
 	go h.run()
-	hubMap[i] = &h
-
-	//log.Println(hubMap)
 
 	return &h
 }
 
-func BroadcastEvent(id uint, eventType string, data interface{}) error {
+// encodes an event, leaving out seq if it is 0
+func encodeEvent(seq uint64, eventType string, data interface{}) ([]byte, error) {
 	eventMap := make(map[string]interface{})
 	eventMap["event"] = eventType
 	eventMap["data"] = data
-	jsonOut, err := json.Marshal(eventMap)
+	if seq != 0 {
+		eventMap["seq"] = seq
+	}
+	return json.Marshal(eventMap)
+}
+
+// Gets the sequence number of the latest event sent in a game, 0 if there have been none
+// connecting with since set to it replays everything sent afterwards
+func LastSeq(id uint) uint64 {
+	return hubs.lastSeq(id)
+}
+
+// sends an event to a game's hub, moving on to the game's next hub if that one was reaped
+func publishEvent(id uint, e *hubEvent) {
+	for {
+		h := hubs.get(id)
+		select {
+		case h.events <- e:
+			return
+		case <-h.done:
+		}
+	}
+}
+
+func BroadcastEvent(id uint, eventType string, data interface{}) error {
+	publishEvent(id, &hubEvent{eventType: eventType, data: data})
+	return nil
+}
+
+// sends an event only to the connections of one player in a game
+// for things only that player should know, like their role or night results
+func SendToPlayer(id uint, playerID uint, eventType string, data interface{}) error {
+	if playerID == 0 {
+		return errors.New("Cannot send to PlayerID 0")
+	}
+	publishEvent(id, &hubEvent{eventType: eventType, playerID: playerID, data: data})
+	return nil
+}
+
+// builds the data of each viewer straight away, so nothing the view reads is kept
+// the viewers are the players in playerIDs, the moderator and spectators
+func buildViews(playerIDs []uint, view ViewFunc) map[viewer]interface{} {
+	views := make(map[viewer]interface{}, len(playerIDs)+2)
+	views[viewer{0, false}] = view(0, false)
+	views[viewer{0, true}] = view(0, true)
+	for _, playerID := range playerIDs {
+		views[viewer{playerID, false}] = view(playerID, false)
+	}
+	return views
+}
+
+// sends an event where each connection gets data built for whoever is watching
+// for things that look different to each player, like chat only some can read
+// connections of players not in playerIDs get what spectators do
+func BroadcastView(id uint, eventType string, playerIDs []uint, view ViewFunc) error {
+	publishEvent(id, &hubEvent{eventType: eventType, views: buildViews(playerIDs, view)})
+	return nil
+}
+
+// same as BroadcastView for the whole state of something, like the game
+// only the latest state is replayed, so the log does not keep a copy of every earlier one
+func BroadcastState(id uint, eventType string, playerIDs []uint, view ViewFunc) error {
+	publishEvent(id, &hubEvent{eventType: eventType, views: buildViews(playerIDs, view), replaces: true})
+	return nil
+}
+
+// sends an event that is not numbered or kept for replaying
+// for things that are stale as soon as they are sent, like the stage countdown
+func BroadcastTransient(id uint, eventType string, data interface{}) error {
+	jsonOut, err := encodeEvent(0, eventType, data)
 	if err != nil {
 		return err
 	}
-	if _, ok := hubMap[id]; ok {
-		hubMap[id].broadcast <- jsonOut
+	return Broadcast(id, jsonOut)
+}
+
+func Broadcast(id uint, b []byte) error {
+	h, ok := hubs.lookup(id)
+	if !ok {
+		return ErrNoHub
+	}
+	select {
+	case h.broadcast <- b:
 		return nil
-	} else {
-		return errors.New("No hub found with that ID")
+	case <-h.done:
+		return ErrNoHub
 	}
 }
 
-func Broadcast(id uint, b []byte) error {
-	if _, ok := hubMap[id]; ok {
-		hubMap[id].broadcast <- b
+// closes every connection of a player in a game
+// for a player who lost their seat, so they stop getting its private events and sending commands as it
+func DropPlayer(id uint, playerID uint) error {
+	if playerID == 0 {
+		return errors.New("Cannot drop PlayerID 0")
+	}
+	h, ok := hubs.lookup(id)
+	if !ok {
+		// without a hub nobody is connected
 		return nil
+	}
+	select {
+	case h.drop <- playerID:
+	case <-h.done:
+	}
+	return nil
+}
+
+// builds the message a connection gets for an event, nil if it does not get it
+func (e *hubEvent) messageFor(c *connection) []byte {
+	if e.playerID != 0 && c.playerID != e.playerID {
+		return nil
+	}
+	if e.messages == nil {
+		return e.message
+	}
+	if m, ok := e.messages[viewer{c.playerID, c.moderator}]; ok {
+		return m
+	}
+	return e.messages[viewer{0, c.moderator}]
+}
+
+// encodes the data of each viewer, viewers who see the same share one message
+func (e *hubEvent) encodeViews() {
+	e.messages = make(map[viewer][]byte, len(e.views))
+	shared := make(map[string][]byte)
+	for v, data := range e.views {
+		if data == nil {
+			continue
+		}
+		jsonOut, err := encodeEvent(e.seq, e.eventType, data)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if m, ok := shared[string(jsonOut)]; ok {
+			jsonOut = m
+		} else {
+			shared[string(jsonOut)] = jsonOut
+		}
+		e.messages[v] = jsonOut
+	}
+	e.views = nil
+}
+
+// numbers an event, adds it to the log and sends it to the connections
+func (h *hub) publish(e *hubEvent) {
+	e.seq = h.seq + 1
+	if e.views == nil {
+		jsonOut, err := encodeEvent(e.seq, e.eventType, e.data)
+		if err != nil {
+			// the event is dropped without using up its number
+			log.Println(err)
+			return
+		}
+		e.message = jsonOut
 	} else {
-		return errors.New("No hub found with that ID")
+		e.encodeViews()
+	}
+	atomic.StoreUint64(&h.seq, e.seq)
+
+	// the state it replaces keeps its place in the log but is no longer sent
+	if e.replaces {
+		if old, ok := h.states[e.eventType]; ok {
+			old.messages = make(map[viewer][]byte)
+		}
+		h.states[e.eventType] = e
+	}
+
+	h.log = append(h.log, e)
+	if len(h.log) > maxEventLog {
+		if h.states[h.log[0].eventType] == h.log[0] {
+			delete(h.states, h.log[0].eventType)
+		}
+		h.log[0] = nil
+		h.log = h.log[1:]
+	}
+
+	for c := range h.connections {
+		if m := e.messageFor(c); m != nil {
+			h.send(c, m)
+		}
+	}
+}
+
+// sends a connection the logged events after since
+// or a Resync if they are no longer kept or since is ahead of the hub
+func (h *hub) replay(c *connection, since uint64) {
+	first := h.seq - uint64(len(h.log)) + 1
+	if since > h.seq || since+1 < first {
+		jsonOut, err := encodeEvent(0, "Resync", Resync{h.seq})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		h.send(c, jsonOut)
+		return
+	}
+
+	for _, e := range h.log[since+1-first:] {
+		m := e.messageFor(c)
+		if m != nil && !h.send(c, m) {
+			return
+		}
 	}
 }
 
 func (h *hub) run() {
 	for {
 		select {
-		case c := <-h.register:
-			h.connections[c] = true
+		case r := <-h.register:
+			h.lastActive = time.Now()
+			h.connections[r.c] = true
+			atomic.AddInt64(&h.connectionCount, 1)
+			if r.replay {
+				h.replay(r.c, r.since)
+			}
 		case c := <-h.unregister:
+			h.lastActive = time.Now()
 			if _, ok := h.connections[c]; ok {
-				delete(h.connections, c)
-				close(c.send)
+				h.remove(c)
+			}
+		case playerID := <-h.drop:
+			for c := range h.connections {
+				if c.playerID == playerID {
+					h.remove(c)
+				}
 			}
 		case m := <-h.broadcast:
 			for c := range h.connections {
-				select {
-				case c.send <- m:
-					//log.Println("sending")
-				default:
-					log.Println("closing")
-					close(c.send)
-					delete(h.connections, c)
+				h.send(c, m)
+			}
+		case e := <-h.events:
+			h.lastActive = time.Now()
+			h.publish(e)
+		case m := <-h.replies:
+			// the connection may have been dropped while the command ran
+			if _, ok := h.connections[m.c]; ok {
+				if m.bind != 0 {
+					m.c.playerID = m.bind
 				}
+				h.send(m.c, m.message)
+			}
+		case reply := <-h.reap:
+			if h.idle() {
+				close(h.done)
+				reply <- reapReply{true, h.seq, atomic.LoadInt32(&h.finished) != 0}
+				return
 			}
+			reply <- reapReply{false, h.seq, false}
 		}
 	}
 }
+
+// whether the hub has gone unused for long enough to be reaped
+// finished games are reaped sooner as nothing more will happen in them
+func (h *hub) idle() bool {
+	if len(h.connections) != 0 {
+		return false
+	}
+	timeout := idleTimeout
+	if atomic.LoadInt32(&h.finished) != 0 {
+		timeout = finishedTimeout
+	}
+	return time.Since(h.lastActive) >= timeout
+}
+
+// removes a connection and closes its messages
+func (h *hub) remove(c *connection) {
+	close(c.send)
+	delete(h.connections, c)
+	atomic.AddInt64(&h.connectionCount, -1)
+}
+
+// queues a message for a connection, dropping the connection if it is backed up
+// returns whether the connection is still there
+func (h *hub) send(c *connection, m []byte) bool {
+	select {
+	case c.send <- m:
+		//log.Println("sending")
+		return true
+	default:
+		log.Println("closing")
+		h.remove(c)
+		return false
+	}
+}
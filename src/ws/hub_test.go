@@ -0,0 +1,177 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// registers a connection for the player with a hub, without a websocket behind it
+func testConnection(h *hub, playerID uint) *connection {
+	c := &connection{send: make(chan []byte, 16), h: h, playerID: playerID}
+	h.register <- registration{c: c}
+	return c
+}
+
+func TestDropPlayer(t *testing.T) {
+	h := makeHub(0)
+	dropped := testConnection(h, 1)
+	kept := testConnection(h, 2)
+	spectator := testConnection(h, 0)
+
+	h.drop <- 1
+	h.broadcast <- []byte("after")
+
+	if _, ok := <-dropped.send; ok {
+		t.Errorf("the dropped player's connection got a message")
+	}
+	for _, c := range []*connection{kept, spectator} {
+		if m, ok := <-c.send; !ok || string(m) != "after" {
+			t.Errorf("connection of PlayerID %d got %q, want the broadcast", c.playerID, m)
+		}
+	}
+}
+
+// publishes plain events numbered after the hub's latest
+func publishEvents(h *hub, count int) {
+	for i := 0; i < count; i++ {
+		h.events <- &hubEvent{eventType: "Test", data: i}
+	}
+}
+
+// connects with since and gets the event types and sequence numbers the hub replays
+// a Resync is given as its Seq with the type Resync
+func replayed(t *testing.T, h *hub, since uint64) []string {
+	c := &connection{send: make(chan []byte, maxEventLog+16), h: h}
+	h.register <- registration{c, since, true}
+	h.broadcast <- []byte("end")
+
+	got := make([]string, 0)
+	for m := range c.send {
+		if string(m) == "end" {
+			break
+		}
+		var e struct {
+			Event string
+			Seq   uint64
+			Data  json.RawMessage
+		}
+		if err := json.Unmarshal(m, &e); err != nil {
+			t.Fatalf("bad message %s: %v", m, err)
+		}
+		if e.Event == "Resync" {
+			var r Resync
+			json.Unmarshal(e.Data, &r)
+			e.Seq = r.Seq
+		}
+		got = append(got, fmt.Sprintf("%s %d", e.Event, e.Seq))
+	}
+	h.unregister <- c
+	return got
+}
+
+func TestReplay(t *testing.T) {
+	h := makeHub(0)
+	publishEvents(h, 3)
+
+	tests := []struct {
+		name  string
+		since uint64
+		want  []string
+	}{
+		{"from the start", 0, []string{"Test 1", "Test 2", "Test 3"}},
+		{"from the middle", 1, []string{"Test 2", "Test 3"}},
+		{"up to date", 3, []string{}},
+		{"ahead of the hub", 4, []string{"Resync 3"}},
+	}
+	for _, test := range tests {
+		got := replayed(t, h, test.since)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReplayTrimmedLog(t *testing.T) {
+	h := makeHub(0)
+	publishEvents(h, maxEventLog+5)
+
+	if got := replayed(t, h, 4); !reflect.DeepEqual(got, []string{fmt.Sprintf("Resync %d", maxEventLog+5)}) {
+		t.Errorf("since a trimmed event got %v, want a resync", got)
+	}
+
+	// the oldest event still kept is 6
+	got := replayed(t, h, 5)
+	if len(got) != maxEventLog || got[0] != "Test 6" || got[len(got)-1] != fmt.Sprintf("Test %d", maxEventLog+5) {
+		t.Errorf("since the last trimmed event got %d events from %v to %v", len(got), got[0], got[len(got)-1])
+	}
+
+	if got := replayed(t, h, 0); len(got) != 1 || !strings.HasPrefix(got[0], "Resync") {
+		t.Errorf("from the start of a trimmed log got %d events, want a resync", len(got))
+	}
+}
+
+func TestReplayHubCarriesOnNumbering(t *testing.T) {
+	h := makeHub(7)
+	publishEvents(h, 1)
+
+	if got := replayed(t, h, 7); !reflect.DeepEqual(got, []string{"Test 8"}) {
+		t.Errorf("got %v, want the one event after 7", got)
+	}
+	if got := replayed(t, h, 6); !reflect.DeepEqual(got, []string{"Resync 8"}) {
+		t.Errorf("got %v, want a resync for events the previous hub sent", got)
+	}
+}
+
+func TestStateReplacesEarlierStates(t *testing.T) {
+	h := makeHub(0)
+	view := func(state string) map[viewer]interface{} {
+		return buildViews([]uint{1}, func(playerID uint, moderator bool) interface{} {
+			return fmt.Sprintf("%s for %d", state, playerID)
+		})
+	}
+	h.events <- &hubEvent{eventType: "Game", views: view("first"), replaces: true}
+	h.events <- &hubEvent{eventType: "Chat", data: "hello"}
+	h.events <- &hubEvent{eventType: "Game", views: view("second"), replaces: true}
+
+	want := []string{"Chat 2", "Game 3"}
+	if got := replayed(t, h, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestViewForEachViewer(t *testing.T) {
+	h := makeHub(0)
+	player := testConnection(h, 1)
+	newcomer := testConnection(h, 2)
+	moderator := &connection{send: make(chan []byte, 16), h: h, moderator: true}
+	h.register <- registration{c: moderator}
+
+	h.events <- &hubEvent{eventType: "Game", views: buildViews([]uint{1}, func(playerID uint, moderator bool) interface{} {
+		if moderator {
+			return "moderator"
+		}
+		if playerID == 0 {
+			return "spectator"
+		}
+		return fmt.Sprintf("player %d", playerID)
+	})}
+
+	tests := []struct {
+		c    *connection
+		want string
+	}{
+		{player, "player 1"},
+		{newcomer, "spectator"}, // not a player when the event was sent
+		{moderator, "moderator"},
+	}
+	for _, test := range tests {
+		var e struct{ Data string }
+		json.Unmarshal(<-test.c.send, &e)
+		if e.Data != test.want {
+			t.Errorf("got %q, want %q", e.Data, test.want)
+		}
+	}
+}
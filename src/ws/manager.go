@@ -0,0 +1,120 @@
+package ws
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// how long a hub without connections or events is kept
+	idleTimeout = 10 * time.Minute
+
+	// how long a finished game's hub is kept once its connections are gone
+	finishedTimeout = time.Minute
+
+	// how often hubs are checked for reaping
+	reapPeriod = time.Minute
+)
+
+// hubManager keeps the hub of every game that has one
+// hubs are made when they are first needed and reaped once nobody uses them
+type hubManager struct {
+	mutex sync.Mutex
+	hubs  map[uint]*hub
+
+	// sequence numbers reaped hubs got up to, so a game's next hub carries on from them
+	// finished games are left out, a connection coming back to one is told to resync
+	lastSeqs map[uint]uint64
+
+	reaper sync.Once
+}
+
+var hubs = &hubManager{
+	hubs:     make(map[uint]*hub),
+	lastSeqs: make(map[uint]uint64),
+}
+
+// gets a game's hub, making it if there is none
+// events go through the hub even when nobody is connected so they can be replayed
+func (m *hubManager) get(id uint) *hub {
+	m.reaper.Do(func() { go m.reapLoop() })
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if h, ok := m.hubs[id]; ok {
+		return h
+	}
+	h := makeHub(m.lastSeqs[id])
+	m.hubs[id] = h
+	return h
+}
+
+// gets a game's hub if it has one
+func (m *hubManager) lookup(id uint) (*hub, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	h, ok := m.hubs[id]
+	return h, ok
+}
+
+// gets the sequence number of a game's latest event
+func (m *hubManager) lastSeq(id uint) uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if h, ok := m.hubs[id]; ok {
+		return atomic.LoadUint64(&h.seq)
+	}
+	return m.lastSeqs[id]
+}
+
+// stops and removes every hub that has been unused for long enough
+func (m *hubManager) reap() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, h := range m.hubs {
+		// asking the hub means nothing can reach it between checking and stopping
+		reply := make(chan reapReply)
+		h.reap <- reply
+		r := <-reply
+		if r.stopped {
+			delete(m.hubs, id)
+			if r.finished {
+				delete(m.lastSeqs, id)
+			} else {
+				m.lastSeqs[id] = r.seq
+			}
+		}
+	}
+}
+
+func (m *hubManager) reapLoop() {
+	ticker := time.NewTicker(reapPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.reap()
+	}
+}
+
+// Gets how many games have a hub and how many connections there are across them
+func Stats() (hubCount int, connectionCount int) {
+	hubs.mutex.Lock()
+	defer hubs.mutex.Unlock()
+
+	for _, h := range hubs.hubs {
+		connectionCount += int(atomic.LoadInt64(&h.connectionCount))
+	}
+	return len(hubs.hubs), connectionCount
+}
+
+// Marks a game as over so its hub is reaped soon after its connections leave
+func FinishHub(id uint) {
+	h, ok := hubs.lookup(id)
+	if ok {
+		atomic.StoreInt32(&h.finished, 1)
+	}
+}